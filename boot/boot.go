@@ -1,15 +1,29 @@
 package boot
 
 import (
+	"context"
 	"os"
+	"time"
 
+	"go-bunrouter-gorm-example/infrastructure/breaker"
+	"go-bunrouter-gorm-example/infrastructure/cache"
 	"go-bunrouter-gorm-example/infrastructure/config"
 	"go-bunrouter-gorm-example/infrastructure/database"
+	"go-bunrouter-gorm-example/infrastructure/idempotency"
+	"go-bunrouter-gorm-example/infrastructure/jobs"
+	"go-bunrouter-gorm-example/infrastructure/lifecycle"
 	"go-bunrouter-gorm-example/infrastructure/limiter"
 	logger "go-bunrouter-gorm-example/infrastructure/log"
+	"go-bunrouter-gorm-example/infrastructure/metrics"
 	"go-bunrouter-gorm-example/infrastructure/redis"
+	"go-bunrouter-gorm-example/infrastructure/retry"
+	"go-bunrouter-gorm-example/infrastructure/scheduler"
+	"go-bunrouter-gorm-example/migrations"
 	"go-bunrouter-gorm-example/module/article"
 	"go-bunrouter-gorm-example/module/health"
+	"go-bunrouter-gorm-example/module/job"
+	"go-bunrouter-gorm-example/module/primitive"
+	"go-bunrouter-gorm-example/module/schedule"
 	"go-bunrouter-gorm-example/utils"
 
 	redisThirdPartyLib "github.com/go-redis/redis"
@@ -17,61 +31,324 @@ import (
 )
 
 type HandlerSetup struct {
-	Limiter     *limiter.RateLimiter
-	HealthHttp  health.InterfaceHttp
-	ArticleHttp article.InterfaceHttp
+	Lifecycle     *lifecycle.Manager
+	Limiter       *limiter.RateLimiter
+	Idempotency   *idempotency.Store
+	Locker        redis.Locker
+	HealthService health.InterfaceService
+	HealthHttp    health.InterfaceHttp
+	ArticleHttp   article.InterfaceHttp
+	JobHttp       job.InterfaceHttp
+	ScheduleHttp  schedule.InterfaceHttp
 }
 
-func MakeHandler() HandlerSetup {
+// LoadConfig initiates the config and the logger, every entry point calls it
+// first and aborts on error
+func LoadConfig() error {
 	//initiate config
-	config.Initialize()
+	if err := config.Initialize(); err != nil {
+		return err
+	}
 
 	//initiate logger
 	logger.Init(config.Conf.LogFormat, config.Conf.LogLevel)
+	return nil
+}
+
+// startupRetry is the backoff policy used while the dependencies come up
+func startupRetry() retry.Policy {
+	return retry.Policy{
+		MaxAttempts:     config.Conf.StartupRetry.MaxAttempts,
+		InitialInterval: config.Conf.StartupRetry.InitialInterval,
+		MaxInterval:     config.Conf.StartupRetry.MaxInterval,
+		MaxElapsed:      config.Conf.StartupRetry.MaxElapsed,
+	}
+}
+
+// breakerSettings maps the config of a dependency breaker
+func breakerSettings(conf config.BreakerConfig, isFailure func(error) bool) breaker.Settings {
+	return breaker.Settings{
+		FailureThreshold:  conf.FailureThreshold,
+		OpenTimeout:       conf.OpenTimeout,
+		HalfOpenMaxCalls:  conf.HalfOpenMaxCalls,
+		SlowCallThreshold: conf.SlowCallThreshold,
+		IsFailure:         isFailure,
+	}
+}
+
+// scheduleTask maps the config of a recurring task, its cron expression was
+// checked with the rest of the config
+func scheduleTask(name string, conf config.ScheduleConfig, run scheduler.TaskFunc) scheduler.Task {
+	cron, err := utils.ParseCron(conf.Cron)
+	if err != nil {
+		log.Fatalf("failed initiate task %s: %v", name, err)
+		os.Exit(1)
+	}
+	return scheduler.Task{
+		Name:     name,
+		Schedule: cron,
+		Enabled:  conf.Enabled,
+		Jitter:   conf.Jitter,
+		Timeout:  conf.Timeout,
+		Run:      run,
+	}
+}
 
+// MakeDatabase opens the postgres connection pool from the loaded config,
+// retrying with backoff while the primary is not reachable yet
+func MakeDatabase() (db database.HandlerDatabase, err error) {
+	err = retry.Do(context.Background(), "connect postgres", startupRetry(), func(context.Context) error {
+		db, err = database.NewDatabaseClient(&config.Conf)
+		return err
+	})
+	return db, err
+}
+
+// MakeMigrator builds a migrator over the embedded migrations
+func MakeMigrator(db database.HandlerDatabase) (*database.Migrator, error) {
+	conn, err := db.DbConn.DB()
+	if err != nil {
+		return nil, err
+	}
+	return database.NewMigrator(conn, migrations.FS)
+}
+
+// MakeRouteHandler wires the http modules without connecting to any
+// dependency, it is only meant to inspect the routes
+func MakeRouteHandler() HandlerSetup {
+	return HandlerSetup{
+		Lifecycle:     lifecycle.New(0),
+		Limiter:       limiter.NewRateLimiter(1, time.Second),
+		Idempotency:   idempotency.NewStore(nil, 0, 0),
+		HealthService: health.NewService(0),
+		HealthHttp:    health.NewHttp(nil),
+		ArticleHttp:   article.NewHttp(nil),
+		JobHttp:       job.NewHttp(nil),
+		ScheduleHttp:  schedule.NewHttp(nil),
+	}
+}
+
+// MakeHandler wires every dependency and module, LoadConfig must have been
+// called before
+func MakeHandler() HandlerSetup {
 	var err error
 
+	//initiate the lifecycle manager, it owns every background worker and
+	//closes the clients below on shutdown
+	lc := lifecycle.New(config.Conf.ShutdownTimeout)
+
 	//initiate a redis client
-	var redisClient *redisThirdPartyLib.Client
-	var redisLibInterface redis.LibInterface
+	var redisClient redisThirdPartyLib.UniversalClient
+	var redisLibInterface redis.ContextLibInterface
+	var redisBreaker *breaker.Breaker
 	if config.Conf.Redis.EnableRedis {
 		redisClient, err = redis.NewRedisClient(&config.Conf)
 		if err != nil {
 			log.Fatalf("failed initiate redis: %v", err)
 			os.Exit(1)
 		}
-		//initiate a redis library interface
-		redisLibInterface, err = redis.NewRedisLibInterface(redisClient)
+		//initiate a redis library interface, retrying while redis comes up
+		err = retry.Do(context.Background(), "connect redis", startupRetry(), func(context.Context) error {
+			redisLibInterface, err = redis.NewRedisLibInterface(redisClient)
+			return err
+		})
 		if err != nil {
 			log.Fatalf("failed initiate redis library: %v", err)
 			os.Exit(1)
 		}
+		//guard redis with a circuit breaker, the article service skips the
+		//cache while it is open
+		redisBreaker = breaker.New("redis", breakerSettings(config.Conf.Redis.Breaker, redis.IsFailure))
+		redisLibInterface = redis.NewBreakerLib(redisLibInterface, redisBreaker)
+		lc.OnShutdown("redis", func(context.Context) error {
+			return redisClient.Close()
+		})
+	}
+
+	//initiate the in-process cache tier, standalone without redis or as an
+	//L1 in front of it that other replicas invalidate over pub/sub
+	var cacheLib cache.Lib
+	if redisLibInterface != nil {
+		cacheLib = redisLibInterface
+	}
+	if config.Conf.Cache.Local.Enabled {
+		local := cache.NewLRU(config.Conf.Cache.Local.MaxEntries)
+		metrics.Publish("cache_local", func() interface{} {
+			return local.Stats()
+		})
+		cacheLib = local
+		if redisLibInterface != nil {
+			bus := redis.NewInvalidationBus(redisLibInterface, config.Conf.Cache.Local.InvalidationChannel)
+			tiered := cache.NewTiered(local, redisLibInterface, config.Conf.Cache.Local.TTL, bus)
+			lc.Loop("cache-invalidation", func(ctx context.Context) {
+				bus.Subscribe(ctx, tiered.Invalidate)
+			})
+			cacheLib = tiered
+		}
 	}
 
 	//setup infrastructure postgres
-	db, err := database.NewDatabaseClient(&config.Conf)
+	db, err := MakeDatabase()
 	if err != nil {
 		log.Fatalf("failed initiate database postgres: %v", err)
 		os.Exit(1)
 	}
+	lc.OnShutdown("postgres", func(context.Context) error {
+		return db.Close()
+	})
+
+	//keep probing the read replicas so routing notices them coming back
+	lc.Loop("postgres-replicas", func(ctx context.Context) {
+		db.Resolver.Run(ctx, config.Conf.Postgres.ReplicaCheckInterval)
+	})
+
+	//run pending migrations at boot when enabled
+	if config.Conf.Postgres.AutoMigrate {
+		migrator, err := MakeMigrator(db)
+		if err != nil {
+			log.Fatalf("failed initiate migrator: %v", err)
+			os.Exit(1)
+		}
+		if _, err = migrator.Up(context.Background()); err != nil {
+			log.Fatalf("failed run migrations: %v", err)
+			os.Exit(1)
+		}
+	}
 
 	//add limiter
-	interval := utils.StringUnitToDuration(config.Conf.Interval)
-	middlewareWithLimiter := limiter.NewRateLimiter(int(config.Conf.Rate), interval)
+	middlewareWithLimiter := limiter.NewRateLimiter(int(config.Conf.Rate), config.Conf.Interval)
+	lc.Loop("limiter", middlewareWithLimiter.Run)
+
+	//hot reload the whitelisted config keys
+	config.OnReload(func(old, new config.Config) {
+		if old.LogLevel != new.LogLevel {
+			logger.SetLevel(new.LogLevel)
+		}
+		if old.Rate != new.Rate || old.Interval != new.Interval {
+			middlewareWithLimiter.Update(int(new.Rate), new.Interval)
+		}
+	})
+	lc.Loop("config-watcher", config.Watch)
+
+	sqlDB, err := db.DbConn.DB()
+	if err != nil {
+		log.Fatalf("failed initiate database pool: %v", err)
+		os.Exit(1)
+	}
+
+	//distributed locks live in redis, or in postgres advisory locks without it
+	var locker redis.Locker
+	if redisLibInterface != nil {
+		locker = redis.NewLocker(redisLibInterface)
+	} else {
+		locker = database.NewAdvisoryLocker(sqlDB)
+	}
+
+	//background jobs are queued in postgres, every replica runs workers
+	queue := jobs.NewQueue(sqlDB, jobs.Settings{
+		PollInterval:      config.Conf.Jobs.PollInterval,
+		VisibilityTimeout: config.Conf.Jobs.VisibilityTimeout,
+		MaxAttempts:       config.Conf.Jobs.MaxAttempts,
+		Concurrency:       config.Conf.Jobs.Concurrency,
+		Backoff: retry.Policy{
+			InitialInterval: config.Conf.Jobs.RetryInitialInterval,
+			MaxInterval:     config.Conf.Jobs.RetryMaxInterval,
+		},
+	})
+
+	//idempotency keys live in redis, or in memory without it
+	idempotencyStore := idempotency.NewStore(redisLibInterface, config.Conf.Idempotency.TTL, config.Conf.Idempotency.InFlightTTL)
 
 	//health module
 	healthRepository := health.NewRepository(db.DbConn)
-	healthService := health.NewService(healthRepository, redisClient)
+	healthService := health.NewService(config.Conf.Cache.HealthTTL)
+	healthService.RegisterChecker(health.Checker{
+		Name:    "postgres",
+		Timeout: health.DefaultCheckTimeout,
+		Check:   healthRepository.CheckUpTimeDB,
+	})
+	for _, name := range db.Resolver.Replicas() {
+		name := name
+		healthService.RegisterChecker(health.Checker{
+			Name:     "postgres-replica-" + name,
+			Timeout:  health.DefaultCheckTimeout,
+			Optional: true,
+			Check: func(ctx context.Context) error {
+				return db.Resolver.CheckReplica(ctx, name)
+			},
+		})
+	}
+	if redisClient != nil {
+		healthService.RegisterChecker(health.Checker{
+			Name:    "redis",
+			Timeout: health.DefaultCheckTimeout,
+			Check: func(ctx context.Context) error {
+				return redisClient.Ping().Err()
+			},
+		})
+	}
+	//publish the circuit breakers in the metrics and as optional checks
+	metrics.Publish("circuit_breakers", func() interface{} {
+		return breaker.Snapshots()
+	})
+	postgresBreaker := breaker.New("postgres", breakerSettings(config.Conf.Postgres.Breaker, article.IsDatabaseFailure))
+	healthService.RegisterChecker(health.BreakerChecker(postgresBreaker))
+	if redisBreaker != nil {
+		healthService.RegisterChecker(health.BreakerChecker(redisBreaker))
+	}
 	healthModule := health.NewHttp(healthService)
 
 	//article module
-	articleRepository := article.NewRepository(db.DbConn)
-	articleService := article.NewService(articleRepository, redisLibInterface)
+	articleRepository := article.NewBreakerRepository(article.NewRepository(db.Resolver), postgresBreaker)
+	//the cache fill lock only pays off when the replicas share the cache
+	var fillLocker redis.Locker
+	if redisLibInterface != nil {
+		fillLocker = locker
+	}
+	articleService := article.NewService(articleRepository, cacheLib, fillLocker, lc, queue)
+	jobs.Handle(queue, primitive.JobKindArticleImport, jobs.HandlerOptions{}, articleService.ImportJob)
 	articleModule := article.NewHttp(articleService)
 
+	//job module
+	jobService := job.NewService(queue)
+	jobModule := job.NewHttp(jobService)
+
+	//workers start once every kind is registered
+	lc.Loop("jobs", queue.Run)
+
+	//schedule module, every replica runs the scheduler and the locker keeps
+	//each task on a single one
+	location, err := time.LoadLocation(config.Conf.Scheduler.TimeZone)
+	if err != nil {
+		log.Fatalf("failed initiate scheduler: %v", err)
+		os.Exit(1)
+	}
+	taskScheduler := scheduler.New(sqlDB, locker, scheduler.Settings{
+		Location:         location,
+		LockTTL:          config.Conf.Scheduler.LockTTL,
+		HistoryRetention: config.Conf.Scheduler.HistoryRetention,
+	})
+	taskScheduler.Register(scheduleTask("purge-articles", config.Conf.Scheduler.PurgeArticles, func(ctx context.Context) (interface{}, error) {
+		return articleService.PurgeDeletedArticles(ctx)
+	}))
+	taskScheduler.Register(scheduleTask("warm-cache", config.Conf.Scheduler.WarmCache, func(ctx context.Context) (interface{}, error) {
+		return articleService.WarmListCache(ctx)
+	}))
+	taskScheduler.Register(scheduleTask("analyze-articles", config.Conf.Scheduler.AnalyzeArticles, func(ctx context.Context) (interface{}, error) {
+		return nil, articleService.AnalyzeArticles(ctx)
+	}))
+	lc.Loop("scheduler", taskScheduler.Run)
+	scheduleModule := schedule.NewHttp(schedule.NewService(taskScheduler))
+
 	return HandlerSetup{
-		Limiter:     middlewareWithLimiter,
-		HealthHttp:  healthModule,
-		ArticleHttp: articleModule,
+		Lifecycle:     lc,
+		Limiter:       middlewareWithLimiter,
+		Idempotency:   idempotencyStore,
+		Locker:        locker,
+		HealthService: healthService,
+		HealthHttp:    healthModule,
+		ArticleHttp:   articleModule,
+		JobHttp:       jobModule,
+		ScheduleHttp:  scheduleModule,
 	}
 }
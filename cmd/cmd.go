@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"go-bunrouter-gorm-example/infrastructure/config"
+)
+
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+const usage = `usage: %s [-env NAME] <command> [arguments]
+
+commands:
+  serve              start the http server (default when no command is given)
+  migrate            apply, revert, inspect or create database migrations
+  seed               insert generated articles, e.g. seed --count 100
+  config validate    print the resolved config with secrets masked
+  routes             list every registered route
+
+flags:
+`
+
+type command func(args []string) int
+
+var commands = map[string]command{
+	"serve":   runServe,
+	"migrate": runMigrate,
+	"seed":    runSeed,
+	"config":  runConfig,
+	"routes":  runRoutes,
+}
+
+// Execute parses the global flags, dispatches to the sub command and returns
+// the process exit code.
+func Execute(args []string) int {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.StringVar(&config.Env, "env", "local", "A config name that used by server")
+	fs.Usage = func() {
+		printUsage(fs.Output(), fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if fs.NArg() == 0 {
+		return runServe(nil)
+	}
+
+	name := fs.Arg(0)
+	if name == "help" {
+		printUsage(os.Stdout, fs)
+		return exitOK
+	}
+	run, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		printUsage(os.Stderr, fs)
+		return exitUsage
+	}
+	return run(fs.Args()[1:])
+}
+
+func printUsage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintf(w, usage, fs.Name())
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"go-bunrouter-gorm-example/boot"
+	"go-bunrouter-gorm-example/infrastructure/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+const configUsage = `usage: config <command>
+
+commands:
+  validate   load and validate the config, print it with secrets masked`
+
+func runConfig(args []string) int {
+	if len(args) != 1 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return exitUsage
+	}
+
+	if err := boot.LoadConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	out, err := yaml.Marshal(config.Conf.Dump())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config validate: %v\n", err)
+		return exitFailure
+	}
+	fmt.Print(string(out))
+	return exitOK
+}
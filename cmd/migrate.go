@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"go-bunrouter-gorm-example/boot"
+	"go-bunrouter-gorm-example/infrastructure/database"
+)
+
+const migrateUsage = `usage: migrate <command>
+
+commands:
+  up                     apply every pending migration
+  down [N]               revert the latest N migrations (default 1)
+  status                 list migrations and whether they are applied
+  create [-dir D] NAME   write a new empty up/down pair to D (default ./migrations)`
+
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return exitUsage
+	}
+
+	if args[0] == "create" {
+		return runMigrateCreate(args[1:])
+	}
+
+	steps := 1
+	switch args[0] {
+	case "up", "status":
+	case "down":
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "invalid number of steps %q\n", args[1])
+				return exitUsage
+			}
+			steps = n
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return exitUsage
+	}
+
+	if err := boot.LoadConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	db, err := boot.MakeDatabase()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed initiate database postgres: %v\n", err)
+		return exitFailure
+	}
+	defer db.Close()
+
+	migrator, err := boot.MakeMigrator(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed initiate migrator: %v\n", err)
+		return exitFailure
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate up: %v\n", err)
+			return exitFailure
+		}
+		fmt.Printf("applied %d migration(s)\n", len(applied))
+	case "down":
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate down: %v\n", err)
+			return exitFailure
+		}
+		fmt.Printf("reverted %d migration(s)\n", len(reverted))
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate status: %v\n", err)
+			return exitFailure
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, row := range status {
+			appliedAt := "pending"
+			if row.AppliedAt != nil {
+				appliedAt = row.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%06d\t%s\t%s\n", row.Version, row.Name, appliedAt)
+		}
+		_ = tw.Flush()
+	}
+	return exitOK
+}
+
+func runMigrateCreate(args []string) int {
+	fs := flag.NewFlagSet("migrate create", flag.ContinueOnError)
+	dir := fs.String("dir", "migrations", "directory holding the migration files")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return exitUsage
+	}
+
+	upPath, downPath, err := database.CreateMigration(*dir, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate create: %v\n", err)
+		return exitFailure
+	}
+	fmt.Printf("created %s\ncreated %s\n", upPath, downPath)
+	return exitOK
+}
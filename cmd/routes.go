@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"go-bunrouter-gorm-example/boot"
+	"go-bunrouter-gorm-example/router"
+)
+
+func runRoutes(args []string) int {
+	fs := flag.NewFlagSet("routes", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	handlerRouter := router.NewHandlerRouter(boot.MakeRouteHandler())
+	routes, err := router.Routes(handlerRouter.RouterWithMiddleware())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "routes: %v\n", err)
+		return exitFailure
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tPATH")
+	for _, route := range routes {
+		fmt.Fprintf(tw, "%s\t%s\n", route.Method, route.Path)
+	}
+	if err := tw.Flush(); err != nil {
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"go-bunrouter-gorm-example/boot"
+	"go-bunrouter-gorm-example/module/article"
+	"go-bunrouter-gorm-example/module/primitive"
+)
+
+const (
+	defaultSeedCount     = 100
+	defaultSeedBatchSize = 500
+)
+
+var (
+	seedFirstNames = []string{"Ayu", "Budi", "Citra", "Dewi", "Eko", "Fajar", "Gita", "Hendra", "Indah", "Joko",
+		"Kartika", "Lestari", "Made", "Nadia", "Oscar", "Putri", "Rizky", "Sari", "Taufik", "Wulan"}
+	seedLastNames = []string{"Pratama", "Santoso", "Wijaya", "Saputra", "Hidayat", "Kusuma", "Nugroho", "Siregar",
+		"Lubis", "Halim", "Gunawan", "Setiawan", "Rahman", "Utami", "Permana"}
+	seedAdjectives = []string{"Practical", "Hidden", "Modern", "Simple", "Effective", "Quiet", "Essential",
+		"Surprising", "Scalable", "Pragmatic", "Lightweight", "Resilient"}
+	seedTopics = []string{"Caching Strategies", "Database Indexing", "Go Concurrency", "API Design",
+		"Rate Limiting", "Observability", "Graceful Shutdown", "Connection Pooling", "Message Queues",
+		"Schema Migrations", "Load Testing", "Error Handling"}
+	seedSentences = []string{
+		"Most teams only notice the problem once traffic starts to grow.",
+		"The first step is to measure before changing anything.",
+		"A small configuration change can remove a whole class of incidents.",
+		"It is tempting to reach for a new tool, but the standard library often suffices.",
+		"Keeping the hot path simple makes the system easier to reason about.",
+		"Every cache needs a clear story for invalidation.",
+		"Timeouts belong on every call that crosses a network boundary.",
+		"Benchmarks on a laptop rarely match what production sees.",
+		"Good defaults matter more than exhaustive options.",
+		"Write the runbook while the details are still fresh.",
+		"Retries without backoff only make an outage worse.",
+		"The database is usually the last place you want to add load.",
+	}
+)
+
+func runSeed(args []string) int {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	count := fs.Int("count", defaultSeedCount, "number of articles to generate")
+	batchSize := fs.Int("batch-size", defaultSeedBatchSize, "number of rows per insert statement")
+	seed := fs.Int64("seed", 0, "random seed, zero picks one from the clock")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *count < 1 || *batchSize < 1 {
+		fmt.Fprintln(os.Stderr, "seed: count and batch-size must be positive")
+		return exitUsage
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	if err := boot.LoadConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	db, err := boot.MakeDatabase()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed initiate database postgres: %v\n", err)
+		return exitFailure
+	}
+	defer db.Close()
+
+	rnd := rand.New(rand.NewSource(*seed))
+	payload := make([]primitive.Article, 0, *count)
+	for i := 0; i < *count; i++ {
+		payload = append(payload, fakeArticle(rnd))
+	}
+
+	repository := article.NewRepository(db.Resolver)
+	created, err := repository.CreateArticles(context.Background(), payload, *batchSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "seed: %v\n", err)
+		return exitFailure
+	}
+	fmt.Printf("seeded %d article(s) with seed %d\n", len(created), *seed)
+	return exitOK
+}
+
+func fakeArticle(rnd *rand.Rand) primitive.Article {
+	author := fmt.Sprintf("%s %s",
+		seedFirstNames[rnd.Intn(len(seedFirstNames))],
+		seedLastNames[rnd.Intn(len(seedLastNames))])
+	title := fmt.Sprintf("%s %s",
+		seedAdjectives[rnd.Intn(len(seedAdjectives))],
+		seedTopics[rnd.Intn(len(seedTopics))])
+
+	paragraphs := make([]string, 2+rnd.Intn(3))
+	for i := range paragraphs {
+		sentences := make([]string, 3+rnd.Intn(4))
+		for j := range sentences {
+			sentences[j] = seedSentences[rnd.Intn(len(seedSentences))]
+		}
+		paragraphs[i] = strings.Join(sentences, " ")
+	}
+
+	createdAt := time.Now().Add(-time.Duration(rnd.Int63n(int64(365 * 24 * time.Hour))))
+	return primitive.Article{
+		Author:    author,
+		Title:     title,
+		Body:      strings.Join(paragraphs, "\n\n"),
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go-bunrouter-gorm-example/boot"
+	"go-bunrouter-gorm-example/infrastructure/config"
+	"go-bunrouter-gorm-example/router"
+)
+
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if err := boot.LoadConfig(); err != nil {
+		log.Print(err)
+		return exitFailure
+	}
+
+	setup := boot.MakeHandler()
+	handlerRouter := router.NewHandlerRouter(setup)
+	app := handlerRouter.RouterWithMiddleware()
+
+	// the port range is enforced by config validation
+	port := fmt.Sprintf(":%d", config.Conf.Port)
+
+	log.Printf("Server running on port %s", port)
+	serve := &http.Server{
+		Addr:    port,
+		Handler: app,
+	}
+
+	// Start server
+	listener, err := net.Listen("tcp", port)
+	if err != nil {
+		log.Printf("failed to listen on port %s: %v", port, err)
+		return exitFailure
+	}
+	setup.HealthService.MarkStarted()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := serve.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+	}()
+
+	// Wait for interrupt signal to gracefully shut down the server
+	quit := make(chan os.Signal, 1)
+	// kill (no param) default sends syscall.SIGTERM
+	// kill -2 is syscall.SIGINT
+	// kill -9 is syscall. SIGKILL but can"t be caught, so don't need to add it
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	exitCode := exitOK
+	select {
+	case <-quit:
+	case err := <-serveErr:
+		log.Printf("server stopped unexpectedly: %v", err)
+		exitCode = exitFailure
+	}
+	log.Println("Shutdown Server ...")
+
+	// flip readiness first and keep serving while the probes notice it, so
+	// load balancers stop routing new traffic here before the listener closes
+	setup.HealthService.MarkShuttingDown()
+	if delay := config.Conf.ShutdownReadinessDelay; delay > 0 {
+		log.Printf("Waiting %s for the readiness probes ...", delay)
+		time.Sleep(delay)
+	}
+
+	// the drain period covers both the in-flight requests and the background
+	// workers owned by the lifecycle manager
+	ctx, cancel := context.WithTimeout(context.Background(), setup.Lifecycle.DrainTimeout())
+	defer cancel()
+	if err := serve.Shutdown(ctx); err != nil {
+		log.Printf("Server Shutdown: %v", err)
+		exitCode = exitFailure
+	}
+	if err := setup.Lifecycle.Shutdown(ctx); err != nil {
+		log.Printf("Lifecycle Shutdown: %v", err)
+		exitCode = exitFailure
+	}
+
+	log.Println("Server exiting")
+	return exitCode
+}
@@ -0,0 +1,249 @@
+package breaker
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 30 * time.Second
+	defaultHalfOpenMaxCalls = 1
+)
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Settings configures a breaker, zero values fall back to the defaults
+type Settings struct {
+	// consecutive failures that open the breaker
+	FailureThreshold int
+	// how long the breaker stays open before letting a trial call through
+	OpenTimeout time.Duration
+	// trial calls allowed while half-open, all of them must succeed to close
+	HalfOpenMaxCalls int
+	// a call slower than this counts as a failure even if it succeeded,
+	// zero disables it
+	SlowCallThreshold time.Duration
+	// IsFailure decides which errors count against the dependency, by
+	// default every non nil error does
+	IsFailure func(err error) bool
+}
+
+// Breaker is a closed / open / half-open circuit breaker that is safe for
+// concurrent use
+type Breaker struct {
+	name     string
+	settings Settings
+	// now is the clock of the breaker, tests replace it
+	now func() time.Time
+
+	mu            sync.Mutex
+	state         State
+	failures      int
+	halfOpenCalls int
+	successes     int
+	openedAt      time.Time
+	rejected      int64
+	transitions   int64
+}
+
+// Snapshot is the state of a breaker as reported by health and metrics
+type Snapshot struct {
+	Name        string `json:"name"`
+	State       string `json:"state"`
+	Failures    int    `json:"failures"`
+	Rejected    int64  `json:"rejected"`
+	Transitions int64  `json:"transitions"`
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*Breaker)
+)
+
+// New creates a breaker and registers it under name so it shows up in
+// Snapshots, a breaker registered again under the same name replaces it
+func New(name string, settings Settings) *Breaker {
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = defaultFailureThreshold
+	}
+	if settings.OpenTimeout <= 0 {
+		settings.OpenTimeout = defaultOpenTimeout
+	}
+	if settings.HalfOpenMaxCalls <= 0 {
+		settings.HalfOpenMaxCalls = defaultHalfOpenMaxCalls
+	}
+	if settings.IsFailure == nil {
+		settings.IsFailure = func(err error) bool { return err != nil }
+	}
+	b := &Breaker{name: name, settings: settings, now: time.Now}
+
+	registryMu.Lock()
+	registry[name] = b
+	registryMu.Unlock()
+	return b
+}
+
+// Snapshots returns the state of every registered breaker sorted by name
+func Snapshots() []Snapshot {
+	registryMu.Lock()
+	breakers := make([]*Breaker, 0, len(registry))
+	for _, b := range registry {
+		breakers = append(breakers, b)
+	}
+	registryMu.Unlock()
+
+	snapshots := make([]Snapshot, 0, len(breakers))
+	for _, b := range breakers {
+		snapshots = append(snapshots, b.Snapshot())
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Name < snapshots[j].Name
+	})
+	return snapshots
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state, an open breaker whose timeout elapsed
+// reports half-open
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expireOpen(b.now())
+	return b.state
+}
+
+func (b *Breaker) Snapshot() Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expireOpen(b.now())
+	return Snapshot{
+		Name:        b.name,
+		State:       b.state.String(),
+		Failures:    b.failures,
+		Rejected:    b.rejected,
+		Transitions: b.transitions,
+	}
+}
+
+// Execute runs fn when the breaker allows it and records the outcome, it
+// returns ErrOpen without calling fn otherwise
+func (b *Breaker) Execute(fn func() error) error {
+	if !b.allow() {
+		return ErrOpen
+	}
+	start := b.now()
+	err := fn()
+	b.record(err, b.now().Sub(start))
+	return err
+}
+
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expireOpen(b.now())
+
+	switch b.state {
+	case StateOpen:
+		b.rejected++
+		return false
+	case StateHalfOpen:
+		if b.halfOpenCalls >= b.settings.HalfOpenMaxCalls {
+			b.rejected++
+			return false
+		}
+		b.halfOpenCalls++
+	}
+	return true
+}
+
+func (b *Breaker) record(err error, elapsed time.Duration) {
+	failed := b.settings.IsFailure(err)
+	if !failed && b.settings.SlowCallThreshold > 0 && elapsed > b.settings.SlowCallThreshold {
+		failed = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.settings.FailureThreshold {
+			b.transition(StateOpen, err, elapsed)
+		}
+	case StateHalfOpen:
+		if failed {
+			b.transition(StateOpen, err, elapsed)
+			return
+		}
+		b.successes++
+		if b.successes >= b.settings.HalfOpenMaxCalls {
+			b.transition(StateClosed, nil, elapsed)
+		}
+	}
+}
+
+// expireOpen moves an open breaker to half-open once its timeout elapsed,
+// b.mu must be held
+func (b *Breaker) expireOpen(now time.Time) {
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.settings.OpenTimeout {
+		b.transition(StateHalfOpen, nil, 0)
+	}
+}
+
+// transition switches state and resets the counters, b.mu must be held
+func (b *Breaker) transition(to State, cause error, elapsed time.Duration) {
+	from := b.state
+	b.state = to
+	b.transitions++
+	b.halfOpenCalls = 0
+	b.successes = 0
+	if to == StateOpen {
+		b.openedAt = b.now()
+	}
+	if to == StateClosed {
+		b.failures = 0
+	}
+
+	entry := log.WithFields(log.Fields{"breaker": b.name, "from": from.String(), "to": to.String()})
+	switch {
+	case cause != nil:
+		entry.Warnf("circuit breaker %s is %s: %v", b.name, to, cause)
+	case to == StateOpen:
+		entry.Warnf("circuit breaker %s is %s: call took %s", b.name, to, elapsed.Round(time.Millisecond))
+	default:
+		entry.Infof("circuit breaker %s is %s", b.name, to)
+	}
+}
@@ -0,0 +1,148 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var errDown = errors.New("down")
+
+// fakeClock is a clock the tests move by hand
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestBreaker(settings Settings) (*Breaker, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	b := New("test", settings)
+	b.now = clock.Now
+	return b, clock
+}
+
+func fail() error {
+	return errDown
+}
+
+func succeed() error {
+	return nil
+}
+
+func TestBreakerTripsAfterThreshold(t *testing.T) {
+	b, _ := newTestBreaker(Settings{FailureThreshold: 3, OpenTimeout: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		_ = b.Execute(fail)
+	}
+	if got := b.State(); got != StateClosed {
+		t.Fatalf("State() after 2 failures = %s, want closed", got)
+	}
+
+	// a success resets the consecutive failures
+	_ = b.Execute(succeed)
+	for i := 0; i < 2; i++ {
+		_ = b.Execute(fail)
+	}
+	if got := b.State(); got != StateClosed {
+		t.Fatalf("State() after a success and 2 failures = %s, want closed", got)
+	}
+
+	_ = b.Execute(fail)
+	if got := b.State(); got != StateOpen {
+		t.Fatalf("State() after 3 failures = %s, want open", got)
+	}
+
+	called := false
+	err := b.Execute(func() error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, ErrOpen) || called {
+		t.Errorf("Execute() on an open breaker = %v, called %t, want ErrOpen without a call", err, called)
+	}
+	if got := b.Snapshot().Rejected; got != 1 {
+		t.Errorf("Snapshot().Rejected = %d, want 1", got)
+	}
+}
+
+func TestBreakerHalfOpenSingleProbe(t *testing.T) {
+	b, clock := newTestBreaker(Settings{FailureThreshold: 1, OpenTimeout: time.Minute, HalfOpenMaxCalls: 1})
+
+	_ = b.Execute(fail)
+	clock.Advance(59 * time.Second)
+	if got := b.State(); got != StateOpen {
+		t.Fatalf("State() before the open timeout = %s, want open", got)
+	}
+	clock.Advance(time.Second)
+	if got := b.State(); got != StateHalfOpen {
+		t.Fatalf("State() after the open timeout = %s, want half-open", got)
+	}
+
+	// while the probe runs every other call is rejected
+	var errConcurrent error
+	err := b.Execute(func() error {
+		errConcurrent = b.Execute(succeed)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Execute() of the probe = %v", err)
+	}
+	if !errors.Is(errConcurrent, ErrOpen) {
+		t.Errorf("Execute() during the probe = %v, want ErrOpen", errConcurrent)
+	}
+	if got := b.State(); got != StateClosed {
+		t.Errorf("State() after a successful probe = %s, want closed", got)
+	}
+}
+
+func TestBreakerHalfOpenFailureReopens(t *testing.T) {
+	b, clock := newTestBreaker(Settings{FailureThreshold: 1, OpenTimeout: time.Minute})
+
+	_ = b.Execute(fail)
+	clock.Advance(time.Minute)
+	_ = b.Execute(fail)
+	if got := b.State(); got != StateOpen {
+		t.Fatalf("State() after a failed probe = %s, want open", got)
+	}
+
+	// the open timeout restarts from the failed probe
+	clock.Advance(30 * time.Second)
+	if got := b.State(); got != StateOpen {
+		t.Errorf("State() 30s after a failed probe = %s, want open", got)
+	}
+}
+
+func TestBreakerSlowCallCountsAsFailure(t *testing.T) {
+	b, clock := newTestBreaker(Settings{FailureThreshold: 1, SlowCallThreshold: time.Second})
+
+	_ = b.Execute(func() error {
+		clock.Advance(2 * time.Second)
+		return nil
+	})
+	if got := b.State(); got != StateOpen {
+		t.Errorf("State() after a slow call = %s, want open", got)
+	}
+}
+
+func TestBreakerIsFailure(t *testing.T) {
+	errMiss := errors.New("miss")
+	b, _ := newTestBreaker(Settings{
+		FailureThreshold: 1,
+		IsFailure: func(err error) bool {
+			return err != nil && !errors.Is(err, errMiss)
+		},
+	})
+
+	_ = b.Execute(func() error { return errMiss })
+	if got := b.State(); got != StateClosed {
+		t.Errorf("State() after an ignored error = %s, want closed", got)
+	}
+}
@@ -0,0 +1,311 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/lifecycle"
+	"go-bunrouter-gorm-example/infrastructure/metrics"
+	"go-bunrouter-gorm-example/infrastructure/redis"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// fillLockPrefix names the locks of the keys being loaded, the locker
+	// namespaces them with its own prefix
+	fillLockPrefix          = "cache-fill:"
+	lockPollInterval        = 50 * time.Millisecond
+	defaultLockTTL          = 5 * time.Second
+	defaultMaxPendingWrites = 100
+)
+
+var ErrInvalidEntry = errors.New("invalid cache entry")
+
+// Lib is where a Guard keeps its entries, redis or an in-process tier
+type Lib interface {
+	redis.LibInterface
+	// GetContext returns every error, a missing key is redis.ErrNil
+	GetContext(ctx context.Context, key string) (string, error)
+}
+
+// Options tunes the stampede protection of a Guard
+type Options struct {
+	// StaleTTL keeps an expired entry for that long, it is served while a
+	// single goroutine refreshes it, zero disables stale-while-revalidate
+	StaleTTL time.Duration
+	// Lock takes a lock from Locker before loading so only one replica hits
+	// the database for a key, the others wait for the entry it writes
+	Lock    bool
+	Locker  redis.Locker
+	LockTTL time.Duration
+	// MaxPendingWrites bounds the cache writes running in the background,
+	// a write over the limit is dropped
+	MaxPendingWrites int
+}
+
+// LoadFunc loads the data of a missing key and tells how long to keep it
+type LoadFunc func(ctx context.Context) (data []byte, ttl time.Duration, err error)
+
+// Stats counts how a Guard answered
+type Stats struct {
+	Hits        int64 `json:"hits"`
+	Misses      int64 `json:"misses"`
+	StaleServes int64 `json:"staleServes"`
+	Coalesced   int64 `json:"coalesced"`
+	// background writes dropped because MaxPendingWrites were running
+	DroppedWrites int64 `json:"droppedWrites"`
+}
+
+// Guard is a cache-aside reader in front of redis that coalesces concurrent
+// loads of a key with singleflight, optionally across replicas with a redis
+// lock, and serves stale entries while they are refreshed
+type Guard struct {
+	redis      Lib
+	background lifecycle.Spawner
+	options    Options
+
+	group      singleflight.Group
+	refreshing sync.Map
+	writes     chan struct{}
+
+	hits        atomic.Int64
+	misses      atomic.Int64
+	staleServes atomic.Int64
+	coalesced   atomic.Int64
+	dropped     atomic.Int64
+}
+
+// NewGuard creates a guard and publishes its stats as cache_<name>, lib may
+// be nil in which case loads are still coalesced. Without a background
+// spawner the writes happen inline, which suits an in-process lib.
+func NewGuard(name string, lib Lib, background lifecycle.Spawner, options Options) *Guard {
+	if options.LockTTL <= 0 {
+		options.LockTTL = defaultLockTTL
+	}
+	if options.MaxPendingWrites <= 0 {
+		options.MaxPendingWrites = defaultMaxPendingWrites
+	}
+	g := &Guard{
+		redis:      lib,
+		background: background,
+		options:    options,
+		writes:     make(chan struct{}, options.MaxPendingWrites),
+	}
+	metrics.Publish("cache_"+name, func() interface{} {
+		return g.Stats()
+	})
+	return g
+}
+
+func (g *Guard) Stats() Stats {
+	return Stats{
+		Hits:          g.hits.Load(),
+		Misses:        g.misses.Load(),
+		StaleServes:   g.staleServes.Load(),
+		Coalesced:     g.coalesced.Load(),
+		DroppedWrites: g.dropped.Load(),
+	}
+}
+
+// enabled reports whether redis is there and its breaker lets calls through
+func (g *Guard) enabled() bool {
+	return g.redis != nil && redis.Available(g.redis)
+}
+
+// Fetch returns the cached data of key, or calls load and caches its result
+// for the ttl it returns. Concurrent fetches of the same key share one load.
+func (g *Guard) Fetch(ctx context.Context, key string, load LoadFunc) ([]byte, error) {
+	if g.enabled() {
+		raw, err := g.redis.GetContext(ctx, key)
+		if err != nil && !errors.Is(err, redis.ErrNil) {
+			log.Warnf("cache: get %s: %v, loading it", key, err)
+		}
+		if err == nil {
+			freshUntil, data, err := decodeEntry(raw)
+			if err == nil {
+				if time.Now().Before(freshUntil) {
+					g.hits.Add(1)
+					return data, nil
+				}
+				// redis only keeps the entry during the stale window
+				g.staleServes.Add(1)
+				g.refresh(key, load)
+				return data, nil
+			}
+		}
+		g.misses.Add(1)
+	}
+
+	leader := false
+	value, err, _ := g.group.Do(key, func() (interface{}, error) {
+		leader = true
+		// the load is shared, a caller giving up must not fail the others
+		return g.load(context.WithoutCancel(ctx), key, load)
+	})
+	if !leader {
+		g.coalesced.Add(1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value.([]byte), nil
+}
+
+// Store writes data under key, fresh for ttl
+func (g *Guard) Store(key string, data []byte, ttl time.Duration) error {
+	if !g.enabled() {
+		return nil
+	}
+	return g.redis.Set(key, encodeEntry(time.Now().Add(ttl), data), ttl+g.options.StaleTTL)
+}
+
+// StoreAsync writes data under key on a background goroutine, the write is
+// dropped when MaxPendingWrites are already running or ctx is done first
+func (g *Guard) StoreAsync(ctx context.Context, key string, data []byte, ttl time.Duration) {
+	if !g.enabled() {
+		return
+	}
+	if g.background == nil {
+		if err := g.Store(key, data, ttl); err != nil {
+			log.Warnf("cache: store %s: %v", key, err)
+		}
+		return
+	}
+	select {
+	case g.writes <- struct{}{}:
+	default:
+		g.dropped.Add(1)
+		log.Debugf("cache: too many pending writes, dropping %s", key)
+		return
+	}
+	started := g.background.Go("cache-store", func(background context.Context) {
+		defer func() { <-g.writes }()
+		if ctx.Err() != nil || background.Err() != nil {
+			g.dropped.Add(1)
+			return
+		}
+		if err := g.Store(key, data, ttl); err != nil {
+			log.Warnf("cache: store %s: %v", key, err)
+		}
+	})
+	if !started {
+		<-g.writes
+		g.dropped.Add(1)
+	}
+}
+
+func (g *Guard) load(ctx context.Context, key string, load LoadFunc) ([]byte, error) {
+	if !g.enabled() {
+		data, _, err := load(ctx)
+		return data, err
+	}
+
+	if g.options.Lock && g.options.Locker != nil {
+		lock, err := g.options.Locker.TryAcquire(ctx, fillLockPrefix+key, g.options.LockTTL)
+		switch {
+		case errors.Is(err, redis.ErrLockHeld):
+			// another replica is loading the key, use its result
+			if data, ok := g.waitForFill(ctx, key); ok {
+				return data, nil
+			}
+		case err != nil:
+			log.Warnf("cache: lock %s: %v, loading without it", key, err)
+		default:
+			defer g.unlock(ctx, lock)
+			// the entry is stored before the lock is released so the
+			// waiting replicas find it
+			data, ttl, err := load(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if err = g.Store(key, data, ttl); err != nil {
+				log.Warnf("cache: store %s: %v", key, err)
+			}
+			return data, nil
+		}
+	}
+
+	data, ttl, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	g.StoreAsync(ctx, key, data, ttl)
+	return data, nil
+}
+
+// refresh reloads a stale key on one background goroutine
+func (g *Guard) refresh(key string, load LoadFunc) {
+	if g.background == nil {
+		return
+	}
+	if _, running := g.refreshing.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+	started := g.background.Go("cache-refresh", func(ctx context.Context) {
+		defer g.refreshing.Delete(key)
+		_, err, _ := g.group.Do(key, func() (interface{}, error) {
+			return g.load(ctx, key, load)
+		})
+		if err != nil {
+			log.Warnf("cache: refresh %s: %v", key, err)
+		}
+	})
+	if !started {
+		g.refreshing.Delete(key)
+	}
+}
+
+// waitForFill polls key until a fresh entry shows up, for at most the lock
+// ttl
+func (g *Guard) waitForFill(ctx context.Context, key string) ([]byte, bool) {
+	timer := time.NewTimer(g.options.LockTTL)
+	defer timer.Stop()
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-timer.C:
+			return nil, false
+		case <-ticker.C:
+			if raw, err := g.redis.GetContext(ctx, key); err == nil {
+				if freshUntil, data, err := decodeEntry(raw); err == nil && time.Now().Before(freshUntil) {
+					return data, true
+				}
+			}
+		}
+	}
+}
+
+// unlock releases the lock, the locker leaves a lock that expired and was
+// taken by another replica meanwhile alone
+func (g *Guard) unlock(ctx context.Context, lock redis.Lock) {
+	if err := lock.Release(ctx); err != nil && !errors.Is(err, redis.ErrLockLost) {
+		log.Warnf("cache: unlock %s: %v", lock.Name(), err)
+	}
+}
+
+// an entry is stored as "<fresh until, unix ms>\n<data>"
+func encodeEntry(freshUntil time.Time, data []byte) string {
+	return strconv.FormatInt(freshUntil.UnixMilli(), 10) + "\n" + string(data)
+}
+
+func decodeEntry(raw string) (time.Time, []byte, error) {
+	header, data, found := strings.Cut(raw, "\n")
+	if !found {
+		return time.Time{}, nil, ErrInvalidEntry
+	}
+	millis, err := strconv.ParseInt(header, 10, 64)
+	if err != nil {
+		return time.Time{}, nil, ErrInvalidEntry
+	}
+	return time.UnixMilli(millis), []byte(data), nil
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/redis"
+	"go-bunrouter-gorm-example/infrastructure/redis/redistest"
+)
+
+func TestGuardCachesLoads(t *testing.T) {
+	ctx := context.Background()
+	g := NewGuard("test_caches", redistest.NewFake(), nil, Options{})
+
+	var loads atomic.Int64
+	load := func(ctx context.Context) ([]byte, time.Duration, error) {
+		loads.Add(1)
+		return []byte("data"), time.Minute, nil
+	}
+	for i := 0; i < 3; i++ {
+		data, err := g.Fetch(ctx, "key", load)
+		if err != nil || string(data) != "data" {
+			t.Fatalf("Fetch() = %q, %v, want data", data, err)
+		}
+	}
+	if got := loads.Load(); got != 1 {
+		t.Errorf("load ran %d times, want 1", got)
+	}
+	if stats := g.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Stats() = %+v, want 2 hits and 1 miss", stats)
+	}
+}
+
+func TestGuardDoesNotCacheErrors(t *testing.T) {
+	ctx := context.Background()
+	g := NewGuard("test_errors", redistest.NewFake(), nil, Options{})
+	errLoad := errors.New("down")
+
+	_, err := g.Fetch(ctx, "key", func(ctx context.Context) ([]byte, time.Duration, error) {
+		return nil, 0, errLoad
+	})
+	if !errors.Is(err, errLoad) {
+		t.Fatalf("Fetch() error = %v, want %v", err, errLoad)
+	}
+	data, err := g.Fetch(ctx, "key", func(ctx context.Context) ([]byte, time.Duration, error) {
+		return []byte("data"), time.Minute, nil
+	})
+	if err != nil || string(data) != "data" {
+		t.Errorf("Fetch() after a failed load = %q, %v, want data", data, err)
+	}
+}
+
+// TestGuardFillLockLoadsOnce runs one guard per replica against a shared
+// redis, the fill lock lets only one of them load the key
+func TestGuardFillLockLoadsOnce(t *testing.T) {
+	ctx := context.Background()
+	fake := redistest.NewFake()
+	locker := redis.NewLocker(fake)
+
+	var loads atomic.Int64
+	release := make(chan struct{})
+	load := func(ctx context.Context) ([]byte, time.Duration, error) {
+		loads.Add(1)
+		<-release
+		return []byte("data"), time.Minute, nil
+	}
+
+	const replicas = 3
+	var wg sync.WaitGroup
+	results := make([]string, replicas)
+	for i := 0; i < replicas; i++ {
+		g := NewGuard("test_fill_lock", fake, nil, Options{Lock: true, Locker: locker, LockTTL: 5 * time.Second})
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data, err := g.Fetch(ctx, "key", load)
+			if err != nil {
+				t.Errorf("Fetch() error = %v", err)
+			}
+			results[i] = string(data)
+		}(i)
+	}
+
+	// let every replica reach the lock before the winner fills the key
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := loads.Load(); got != 1 {
+		t.Errorf("load ran %d times across replicas, want 1", got)
+	}
+	for i, result := range results {
+		if result != "data" {
+			t.Errorf("replica %d fetched %q, want data", i, result)
+		}
+	}
+	if _, err := locker.TryAcquire(ctx, fillLockPrefix+"key", time.Second); err != nil {
+		t.Errorf("TryAcquire() of the fill lock error = %v, want it released", err)
+	}
+}
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// missingMarker is stored in place of a value that was not found
+const missingMarker = "missing"
+
+var errCodecMismatch = errors.New("cache entry has another codec")
+
+// Entity is the caching policy of one kind of value
+type Entity struct {
+	TTL time.Duration
+	// NegativeTTL caches a NotFound result for that long, zero disables it
+	NegativeTTL time.Duration
+	// NotFound is the error load returns for a missing value, it is
+	// returned again when the miss is served from the cache
+	NotFound error
+	// Codec defaults to JSON
+	Codec Codec
+}
+
+func (e Entity) codec() Codec {
+	if e.Codec == nil {
+		return JSON
+	}
+	return e.Codec
+}
+
+// GetOrLoad returns the value cached under key, or calls load and caches the
+// result through g. Concurrent calls for the same key share one load.
+func GetOrLoad[T any](ctx context.Context, g *Guard, entity Entity, key string, load func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	loadEntry := func(ctx context.Context) ([]byte, time.Duration, error) {
+		value, err := load(ctx)
+		if err != nil {
+			if entity.NegativeTTL > 0 && entity.NotFound != nil && errors.Is(err, entity.NotFound) {
+				return []byte(missingMarker + ":"), entity.NegativeTTL, nil
+			}
+			return nil, 0, err
+		}
+		data, err := encode(entity, value)
+		return data, entity.TTL, err
+	}
+
+	data, err := g.Fetch(ctx, key, loadEntry)
+	if err != nil {
+		return zero, err
+	}
+	value, err := decode[T](entity, data)
+	if err == nil || errors.Is(err, entity.NotFound) {
+		return value, err
+	}
+
+	// an entry written by another codec or version of T, load it again and
+	// overwrite it
+	log.Warnf("cache: decode %s: %v, reloading", key, err)
+	data, ttl, err := loadEntry(ctx)
+	if err != nil {
+		return zero, err
+	}
+	g.StoreAsync(ctx, key, data, ttl)
+	return decode[T](entity, data)
+}
+
+// Put writes value under key in the background, e.g. right after creating it
+func Put[T any](ctx context.Context, g *Guard, entity Entity, key string, value T) error {
+	data, err := encode(entity, value)
+	if err != nil {
+		return err
+	}
+	g.StoreAsync(ctx, key, data, entity.TTL)
+	return nil
+}
+
+// Set writes value under key and waits for the write, e.g. to warm the cache
+// ahead of the readers
+func Set[T any](g *Guard, entity Entity, key string, value T) error {
+	data, err := encode(entity, value)
+	if err != nil {
+		return err
+	}
+	return g.Store(key, data, entity.TTL)
+}
+
+// an entry is stored as "<codec name>:<payload>" or "missing:"
+func encode(entity Entity, value interface{}) ([]byte, error) {
+	payload, err := entity.codec().Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(entity.codec().Name()+":"), payload...), nil
+}
+
+func decode[T any](entity Entity, data []byte) (T, error) {
+	var value T
+	name, payload, found := bytes.Cut(data, []byte(":"))
+	switch {
+	case !found:
+		return value, ErrInvalidEntry
+	case string(name) == missingMarker:
+		if entity.NotFound == nil {
+			return value, ErrInvalidEntry
+		}
+		return value, entity.NotFound
+	case string(name) != entity.codec().Name():
+		return value, errCodecMismatch
+	}
+	err := entity.codec().Unmarshal(payload, &value)
+	return value, err
+}
@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/redis"
+)
+
+const defaultMaxEntries = 10_000
+
+// LRU is an in-process cache bounded by entry count and ttl, it implements
+// Lib so it can stand in for redis or sit in front of it.
+// The counters written by Incr are pinned, they are never evicted and do not
+// count towards the bound since losing one, e.g. the list generation, would
+// bring back the entries cached under an older value.
+type LRU struct {
+	maxEntries int
+	// now is the clock of the ttls, tests replace it
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	pinned  int
+
+	evictions atomic.Int64
+}
+
+type lruEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+	pinned    bool
+}
+
+// LRUStats is what the metrics endpoint reports for an LRU
+type LRUStats struct {
+	Entries   int   `json:"entries"`
+	Evictions int64 `json:"evictions"`
+}
+
+var _ Lib = (*LRU)(nil)
+
+func NewLRU(maxEntries int) *LRU {
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+	return &LRU{
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (c *LRU) Stats() LRUStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return LRUStats{
+		Entries:   c.order.Len() - c.pinned,
+		Evictions: c.evictions.Load(),
+	}
+}
+
+// lookup returns the live entry of key and marks it recently used, c.mu must
+// be held
+func (c *LRU) lookup(key string) (*lruEntry, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && !c.now().Before(entry.expiresAt) {
+		c.remove(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry, true
+}
+
+// store sets key and evicts the least recently used entries over the
+// limit, a zero ttl never expires, c.mu must be held
+func (c *LRU) store(key, value string, ttl time.Duration, pinned bool) {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = c.now().Add(ttl)
+	}
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt, pinned: pinned})
+	if pinned {
+		c.pinned++
+	}
+
+	element := c.order.Back()
+	for element != nil && c.order.Len()-c.pinned > c.maxEntries {
+		prev := element.Prev()
+		if !element.Value.(*lruEntry).pinned {
+			c.remove(element)
+			c.evictions.Add(1)
+		}
+		element = prev
+	}
+}
+
+func (c *LRU) remove(element *list.Element) {
+	entry := element.Value.(*lruEntry)
+	if entry.pinned {
+		c.pinned--
+	}
+	c.order.Remove(element)
+	delete(c.entries, entry.key)
+}
+
+func (c *LRU) Get(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.lookup(key); ok {
+		return entry.value
+	}
+	return ""
+}
+
+// GetContext reports a missing key as redis.ErrNil like redis does
+func (c *LRU) GetContext(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.lookup(key); ok {
+		return entry.value, nil
+	}
+	return "", redis.ErrNil
+}
+
+func (c *LRU) Set(key string, value interface{}, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store(key, toString(value), ttl, false)
+	return nil
+}
+
+func (c *LRU) SetNX(key string, value interface{}, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.lookup(key); ok {
+		return false, nil
+	}
+	c.store(key, toString(value), ttl, false)
+	return true, nil
+}
+
+func (c *LRU) SetIdempotencyKey(key string, value interface{}, ttl time.Duration) error {
+	ok, err := c.SetNX(key, value, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return redis.ErrMultipleKeyInCache
+	}
+	return nil
+}
+
+func (c *LRU) DeleteKey(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	return nil
+}
+
+// Incr increments the integer stored at key like redis INCR, keeping its ttl
+func (c *LRU) Incr(key string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var value int64
+	var ttl time.Duration
+	if entry, ok := c.lookup(key); ok {
+		current, err := strconv.ParseInt(entry.value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("incr %s: value is not an integer", key)
+		}
+		value = current
+		if !entry.expiresAt.IsZero() {
+			ttl = entry.expiresAt.Sub(c.now())
+		}
+	}
+	value++
+	c.store(key, strconv.FormatInt(value, 10), ttl, true)
+	return value, nil
+}
+
+// toString mirrors how go-redis writes a value
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
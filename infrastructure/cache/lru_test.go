@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/redis"
+)
+
+// newTestLRU returns an LRU whose clock only moves when advance is called
+func newTestLRU(maxEntries int) (*LRU, func(d time.Duration)) {
+	now := time.Unix(0, 0)
+	c := NewLRU(maxEntries)
+	c.now = func() time.Time { return now }
+	return c, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c, _ := newTestLRU(2)
+
+	_ = c.Set("a", "1", 0)
+	_ = c.Set("b", "2", 0)
+	// reading a makes b the least recently used
+	if got := c.Get("a"); got != "1" {
+		t.Fatalf("Get(a) = %q, want 1", got)
+	}
+	_ = c.Set("c", "3", 0)
+
+	if got := c.Get("b"); got != "" {
+		t.Errorf("Get(b) = %q, want it evicted", got)
+	}
+	for key, want := range map[string]string{"a": "1", "c": "3"} {
+		if got := c.Get(key); got != want {
+			t.Errorf("Get(%s) = %q, want %q", key, got, want)
+		}
+	}
+	if stats := c.Stats(); stats.Entries != 2 || stats.Evictions != 1 {
+		t.Errorf("Stats() = %+v, want 2 entries and 1 eviction", stats)
+	}
+}
+
+func TestLRUExpiresEntries(t *testing.T) {
+	c, advance := newTestLRU(10)
+
+	_ = c.Set("short", "1", time.Second)
+	_ = c.Set("forever", "2", 0)
+
+	advance(999 * time.Millisecond)
+	if got := c.Get("short"); got != "1" {
+		t.Errorf("Get(short) before its ttl = %q, want 1", got)
+	}
+	advance(time.Millisecond)
+	if _, err := c.GetContext(context.Background(), "short"); !errors.Is(err, redis.ErrNil) {
+		t.Errorf("GetContext(short) after its ttl error = %v, want redis.ErrNil", err)
+	}
+	advance(24 * time.Hour)
+	if got := c.Get("forever"); got != "2" {
+		t.Errorf("Get(forever) = %q, want 2", got)
+	}
+
+	// an expired key can be claimed again
+	if ok, _ := c.SetNX("short", "3", time.Second); !ok {
+		t.Error("SetNX(short) after its ttl = false, want true")
+	}
+}
+
+func TestLRUKeepsPinnedCounters(t *testing.T) {
+	c, _ := newTestLRU(2)
+
+	if value, err := c.Incr("generation"); err != nil || value != 1 {
+		t.Fatalf("Incr(generation) = %d, %v, want 1", value, err)
+	}
+	for _, key := range []string{"a", "b", "c", "d"} {
+		_ = c.Set(key, key, 0)
+	}
+
+	if got := c.Get("generation"); got != "1" {
+		t.Errorf("Get(generation) = %q, want the pinned counter to survive eviction", got)
+	}
+	if stats := c.Stats(); stats.Entries != 2 {
+		t.Errorf("Stats().Entries = %d, want 2 without the pinned counter", stats.Entries)
+	}
+	if value, _ := c.Incr("generation"); value != 2 {
+		t.Errorf("Incr(generation) = %d, want 2", value)
+	}
+
+	// a deleted counter starts over
+	_ = c.DeleteKey("generation")
+	if value, _ := c.Incr("generation"); value != 1 {
+		t.Errorf("Incr(generation) after DeleteKey = %d, want 1", value)
+	}
+}
+
+func TestLRUIncrKeepsTTL(t *testing.T) {
+	c, advance := newTestLRU(10)
+
+	_ = c.Set("counter", "5", 10*time.Second)
+	advance(6 * time.Second)
+	if value, err := c.Incr("counter"); err != nil || value != 6 {
+		t.Fatalf("Incr(counter) = %d, %v, want 6", value, err)
+	}
+
+	advance(3 * time.Second)
+	if got := c.Get("counter"); got != "6" {
+		t.Errorf("Get(counter) before its ttl = %q, want 6", got)
+	}
+	advance(time.Second)
+	if got := c.Get("counter"); got != "" {
+		t.Errorf("Get(counter) = %q, want the original ttl to expire it", got)
+	}
+
+	_ = c.Set("text", "abc", 0)
+	if _, err := c.Incr("text"); err == nil {
+		t.Error("Incr(text) of a non integer returned no error")
+	}
+}
+
+func TestLRUSetIdempotencyKey(t *testing.T) {
+	c, _ := newTestLRU(10)
+
+	if err := c.SetIdempotencyKey("key", "1", time.Minute); err != nil {
+		t.Fatalf("SetIdempotencyKey() error = %v", err)
+	}
+	if err := c.SetIdempotencyKey("key", "2", time.Minute); !errors.Is(err, redis.ErrMultipleKeyInCache) {
+		t.Errorf("SetIdempotencyKey() of a held key error = %v, want redis.ErrMultipleKeyInCache", err)
+	}
+}
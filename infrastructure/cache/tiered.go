@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/breaker"
+	"go-bunrouter-gorm-example/infrastructure/redis"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Invalidator tells the other replicas that a key changed
+type Invalidator interface {
+	Publish(key string) error
+}
+
+// Tiered serves reads from an in-process L1 and falls back to redis as L2.
+// Writes go to both and are broadcast so the other replicas drop their L1
+// copy, locks and idempotency keys only live in redis.
+type Tiered struct {
+	l1    *LRU
+	l2    redis.ContextLibInterface
+	l1TTL time.Duration
+	bus   Invalidator
+}
+
+var _ Lib = (*Tiered)(nil)
+
+// NewTiered keeps L1 copies for at most l1TTL, which bounds staleness when
+// an invalidation is lost. bus may be nil for a single replica.
+func NewTiered(l1 *LRU, l2 redis.ContextLibInterface, l1TTL time.Duration, bus Invalidator) *Tiered {
+	return &Tiered{
+		l1:    l1,
+		l2:    l2,
+		l1TTL: l1TTL,
+		bus:   bus,
+	}
+}
+
+// Invalidate drops the L1 copy of key, it is called for the keys other
+// replicas changed
+func (t *Tiered) Invalidate(key string) {
+	_ = t.l1.DeleteKey(key)
+}
+
+func (t *Tiered) localTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 || ttl > t.l1TTL {
+		return t.l1TTL
+	}
+	return ttl
+}
+
+func (t *Tiered) publish(key string) {
+	if t.bus == nil {
+		return
+	}
+	if err := t.bus.Publish(key); err != nil {
+		log.Warnf("cache: publish invalidation of %s: %v", key, err)
+	}
+}
+
+func (t *Tiered) Get(key string) string {
+	if value := t.l1.Get(key); value != "" {
+		return value
+	}
+	if !redis.Available(t.l2) {
+		return ""
+	}
+	value := t.l2.Get(key)
+	if value != "" {
+		_ = t.l1.Set(key, value, t.l1TTL)
+	}
+	return value
+}
+
+// GetContext reads L1 first, a redis error is returned while a missing key
+// is redis.ErrNil
+func (t *Tiered) GetContext(ctx context.Context, key string) (string, error) {
+	if value, err := t.l1.GetContext(ctx, key); err == nil {
+		return value, nil
+	}
+	if !redis.Available(t.l2) {
+		return "", redis.ErrNil
+	}
+	value, err := t.l2.GetContext(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	_ = t.l1.Set(key, value, t.l1TTL)
+	return value, nil
+}
+
+// Set writes L1 even when redis fails, the redis error is still returned.
+// While the redis breaker is open only L1 is written.
+func (t *Tiered) Set(key string, value interface{}, ttl time.Duration) error {
+	_ = t.l1.Set(key, value, t.localTTL(ttl))
+	if !redis.Available(t.l2) {
+		return nil
+	}
+	err := t.l2.Set(key, value, ttl)
+	t.publish(key)
+	return err
+}
+
+// DeleteKey drops the L1 copy even when redis fails, while the redis breaker
+// is open only L1 is deleted
+func (t *Tiered) DeleteKey(key string) error {
+	_ = t.l1.DeleteKey(key)
+	if !redis.Available(t.l2) {
+		return nil
+	}
+	err := t.l2.DeleteKey(key)
+	t.publish(key)
+	return err
+}
+
+// Incr counts in redis only, it fails with breaker.ErrOpen while the redis
+// breaker is open
+func (t *Tiered) Incr(key string) (int64, error) {
+	_ = t.l1.DeleteKey(key)
+	if !redis.Available(t.l2) {
+		return 0, breaker.ErrOpen
+	}
+	value, err := t.l2.Incr(key)
+	t.publish(key)
+	return value, err
+}
+
+func (t *Tiered) SetNX(key string, value interface{}, ttl time.Duration) (bool, error) {
+	return t.l2.SetNX(key, value, ttl)
+}
+
+func (t *Tiered) SetIdempotencyKey(key string, value interface{}, ttl time.Duration) error {
+	return t.l2.SetIdempotencyKey(key, value, ttl)
+}
@@ -2,32 +2,51 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/go-redis/redis"
+	"github.com/mitchellh/mapstructure"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	_ "github.com/spf13/viper/remote"
 )
 
+const envPrefix = "TEST_CACHE_CQRS"
+
 func initialiseRemote(v *viper.Viper) error {
 	consulUrl := os.Getenv("CONSUL_URL")
-	_ = v.AddRemoteProvider("consul", consulUrl, "TEST_CACHE_CQRS")
+	_ = v.AddRemoteProvider("consul", consulUrl, envPrefix)
 	v.SetConfigType("yaml")
 	return v.ReadRemoteConfig()
 }
 
-func initialiseFileAndEnv(v *viper.Viper, env string) error {
+func initialiseFile(v *viper.Viper, env string) error {
 	v.SetConfigName(configName[env])
 	for _, path := range searchPath {
 		v.AddConfigPath(path)
 	}
-	v.SetEnvPrefix("TEST_CACHE_CQRS")
+
+	return v.ReadInConfig()
+}
+
+// initialiseEnv binds every config key to its environment variable, binding
+// explicitly makes keys that are missing from the file and the defaults
+// overridable too
+func initialiseEnv(v *viper.Viper) error {
+	v.SetEnvPrefix(envPrefix)
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	v.AutomaticEnv()
 
-	return v.ReadInConfig()
+	for _, key := range Keys() {
+		if err := v.BindEnv(key); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func initialiseDefaults(v *viper.Viper) {
@@ -36,23 +55,98 @@ func initialiseDefaults(v *viper.Viper) {
 	}
 }
 
-func Initialize() {
+// Initialize loads the config from the remote provider or the config file,
+// applies the environment overrides and validates the result. The returned
+// error lists every problem found.
+func Initialize() error {
 	v := viper.New()
 	initialiseDefaults(v)
+	if err := initialiseEnv(v); err != nil {
+		return err
+	}
+	source := sourceRemote
 	if err := initialiseRemote(v); err != nil {
+		source = sourceFile
 		log.Warningf("No remote server configured will load configuration from file and environment variables: %+v", err)
-		if err := initialiseFileAndEnv(v, Env); err != nil {
+		if err := initialiseFile(v, Env); err != nil {
 			var configFileNotFoundError viper.ConfigFileNotFoundError
-			if errors.As(err, &configFileNotFoundError) {
-				log.Warning("No 'config.yaml' file found on search paths. Will either use environment variables or defaults")
+			if !errors.As(err, &configFileNotFoundError) {
+				return fmt.Errorf("error reading configuration file: %w", err)
 			}
+			source = sourceNone
+			log.Warning("No 'config.yaml' file found on search paths. Will either use environment variables or defaults")
 		}
 	}
 
-	err := v.Unmarshal(&Conf)
+	conf, err := load(v)
 	if err != nil {
-		log.Printf("Error un-marshalling configuration: %s", err.Error())
+		return err
 	}
+
+	Conf = conf
+	current.Store(&conf)
+	watched = watchState{viper: v, source: source}
+	return nil
+}
+
+// load decodes and validates the config, decoding and validation problems
+// are reported together
+func load(v *viper.Viper) (Config, error) {
+	var conf Config
+	var problems []string
+	failedKeys := make(map[string]bool)
+
+	settings := v.AllSettings()
+	secretProblems, secretKeys := resolveSecrets(settings)
+	problems = append(problems, secretProblems...)
+	for _, key := range secretKeys {
+		failedKeys[strings.ToLower(key)] = true
+	}
+
+	// same decoder settings as viper.Unmarshal, but over the resolved settings
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			durationDecodeHook(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+		Result:           &conf,
+		WeaklyTypedInput: true,
+	})
+	if err != nil {
+		return Config{}, err
+	}
+	if err = decoder.Decode(settings); err != nil {
+		var decodeErr *mapstructure.Error
+		if !errors.As(err, &decodeErr) {
+			return Config{}, fmt.Errorf("error un-marshalling configuration: %w", err)
+		}
+		for _, problem := range decodeErr.Errors {
+			problems = append(problems, problem)
+			if match := decodeKeyRegex.FindStringSubmatch(problem); match != nil {
+				failedKeys[strings.ToLower(match[1])] = true
+			}
+		}
+	}
+	conf.LogLevel = strings.ToLower(conf.LogLevel)
+	conf.LogFormat = strings.ToLower(conf.LogFormat)
+
+	if err = conf.Validate(); err != nil {
+		var validationErr ValidationError
+		if !errors.As(err, &validationErr) {
+			return Config{}, err
+		}
+		for i, problem := range validationErr.Problems {
+			// a field that failed decoding is zero and would be reported twice
+			if !failedKeys[strings.ToLower(validationErr.Keys[i])] {
+				problems = append(problems, problem)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return Config{}, ValidationError{Problems: problems}
+	}
+	return conf, nil
 }
 
 var (
@@ -66,16 +160,86 @@ var (
 	EnvironmentProd  = "PROD"
 	ListOfIsland     map[uint64]string
 
+	decodeKeyRegex = regexp.MustCompile(`^error decoding '([^']+)'`)
+
 	searchPath = []string{
 		"/etc/test_cache_CQRS",
 		"$HOME/.test_cache_CQRS",
 		".",
 	}
 	configDefaults = map[string]interface{}{
-		"port":       1234,
-		"logLevel":   "DEBUG",
-		"logFormat":  "text",
-		"signString": "supersecret",
+		"port":                              1234,
+		"logLevel":                          "DEBUG",
+		"logFormat":                         "text",
+		"signString":                        "supersecret",
+		"interval":                          "1s",
+		"shutdownTimeout":                   "15s",
+		"shutdownReadinessDelay":            "5s",
+		"remotePollInterval":                "30s",
+		"startupRetry.maxAttempts":          10,
+		"startupRetry.initialInterval":      "500ms",
+		"startupRetry.maxInterval":          "10s",
+		"startupRetry.maxElapsed":           "1m",
+		"cache.articleTTL":                  "1m",
+		"cache.articleListTTL":              "1m",
+		"cache.lockTTL":                     "5s",
+		"cache.codec":                       "json",
+		"cache.maxPendingWrites":            100,
+		"cache.local.maxEntries":            10000,
+		"cache.local.ttl":                   "10s",
+		"cache.local.invalidationChannel":   "cache:invalidate",
+		"postgres.port":                     5432,
+		"postgres.sslMode":                  "disable",
+		"postgres.timeZone":                 "Asia/Jakarta",
+		"postgres.applicationName":          "go-bunrouter-gorm-example",
+		"postgres.connectTimeout":           "10s",
+		"postgres.connMaxLifetime":          "5m",
+		"postgres.maxOpenConnections":       10,
+		"postgres.maxIdleConnections":       10,
+		"postgres.replicaCheckInterval":     "10s",
+		"idempotency.ttl":                   "24h",
+		"idempotency.inFlightTTL":           "1m",
+		"idempotency.maxBodyBytes":          1048576,
+		"articles.batchMaxItems":            1000,
+		"articles.batchSize":                100,
+		"articles.exportStatementTimeout":   "10m",
+		"articles.importMaxBytes":           10485760,
+		"articles.importMaxErrors":          100,
+		"jobs.pollInterval":                 "1s",
+		"jobs.visibilityTimeout":            "5m",
+		"jobs.maxAttempts":                  5,
+		"jobs.concurrency":                  2,
+		"jobs.retryInitialInterval":         "10s",
+		"jobs.retryMaxInterval":             "10m",
+		"articles.purgeAfter":               "720h",
+		"cache.warmPages":                   5,
+		"scheduler.timeZone":                "UTC",
+		"scheduler.lockTTL":                 "1m",
+		"scheduler.historyRetention":        "720h",
+		"scheduler.purgeArticles.enabled":   true,
+		"scheduler.purgeArticles.cron":      "0 3 * * *",
+		"scheduler.purgeArticles.jitter":    "5m",
+		"scheduler.purgeArticles.timeout":   "30m",
+		"scheduler.warmCache.enabled":       true,
+		"scheduler.warmCache.cron":          "*/5 * * * *",
+		"scheduler.warmCache.jitter":        "30s",
+		"scheduler.warmCache.timeout":       "1m",
+		"scheduler.analyzeArticles.enabled": true,
+		"scheduler.analyzeArticles.cron":    "30 3 * * *",
+		"scheduler.analyzeArticles.jitter":  "5m",
+		"scheduler.analyzeArticles.timeout": "30m",
+		"redis.mode":                        "standalone",
+		"redis.port":                        6379,
+		"redis.dialTimeout":                 "5s",
+		"redis.readTimeout":                 "3s",
+		"redis.writeTimeout":                "3s",
+		"redis.breaker.failureThreshold":    5,
+		"redis.breaker.openTimeout":         "30s",
+		"redis.breaker.halfOpenMaxCalls":    1,
+		"redis.breaker.slowCallThreshold":   "500ms",
+		"postgres.breaker.failureThreshold": 5,
+		"postgres.breaker.openTimeout":      "30s",
+		"postgres.breaker.halfOpenMaxCalls": 1,
 	}
 	configName = map[string]string{
 		"local": "config.local",
@@ -87,34 +251,209 @@ var (
 )
 
 type Config struct {
-	Env       string         `mapstructure:"env"`
-	Port      int            `mapstructure:"port"`
-	LogLevel  string         `mapstructure:"logLevel"`
-	LogMode   bool           `mapstructure:"logMode"`
-	LogFormat string         `mapstructure:"logFormat"`
-	Postgres  PostgresConfig `mapstructure:"postgres"`
-	Redis     RedisConfig    `mapstructure:"redis"`
-	Rate      int64          `mapstructure:"rate"`
-	Interval  string         `mapstructure:"interval"`
+	Env             string         `mapstructure:"env"`
+	Port            int            `mapstructure:"port" validate:"min=1,max=65535"`
+	LogLevel        string         `mapstructure:"logLevel" validate:"oneof=debug info warn error"`
+	LogMode         bool           `mapstructure:"logMode"`
+	LogFormat       string         `mapstructure:"logFormat" validate:"oneof=text json"`
+	Postgres        PostgresConfig `mapstructure:"postgres"`
+	Redis           RedisConfig    `mapstructure:"redis"`
+	Rate            int64          `mapstructure:"rate" validate:"gt=0"`
+	Interval        time.Duration  `mapstructure:"interval" validate:"gt=0"`
+	ShutdownTimeout time.Duration  `mapstructure:"shutdownTimeout" validate:"gt=0"`
+	// how long /readyz answers 503 before the listener closes, so the probes
+	// see it and load balancers stop routing here
+	ShutdownReadinessDelay time.Duration `mapstructure:"shutdownReadinessDelay" validate:"gte=0"`
+	// how often the remote provider is polled for changes
+	RemotePollInterval time.Duration     `mapstructure:"remotePollInterval" validate:"gt=0"`
+	Cache              CacheConfig       `mapstructure:"cache"`
+	StartupRetry       RetryConfig       `mapstructure:"startupRetry"`
+	Idempotency        IdempotencyConfig `mapstructure:"idempotency"`
+	Articles           ArticlesConfig    `mapstructure:"articles"`
+	Jobs               JobsConfig        `mapstructure:"jobs"`
+	Scheduler          SchedulerConfig   `mapstructure:"scheduler"`
+	Admin              AdminConfig       `mapstructure:"admin"`
+}
+
+// SchedulerConfig configures the recurring maintenance tasks
+type SchedulerConfig struct {
+	// time zone of the cron expressions
+	TimeZone string `mapstructure:"timeZone" validate:"timezone"`
+	// lease of the lock a replica holds while it runs a task
+	LockTTL time.Duration `mapstructure:"lockTTL" validate:"gt=0"`
+	// how long the run history of a task is kept
+	HistoryRetention time.Duration  `mapstructure:"historyRetention" validate:"gt=0"`
+	PurgeArticles    ScheduleConfig `mapstructure:"purgeArticles"`
+	WarmCache        ScheduleConfig `mapstructure:"warmCache"`
+	AnalyzeArticles  ScheduleConfig `mapstructure:"analyzeArticles"`
+}
+
+// ScheduleConfig configures when a task runs
+type ScheduleConfig struct {
+	// a disabled task only runs when asked to
+	Enabled bool   `mapstructure:"enabled"`
+	Cron    string `mapstructure:"cron" validate:"cron"`
+	// each run is delayed by a random duration up to jitter
+	Jitter time.Duration `mapstructure:"jitter" validate:"gte=0"`
+	// a run taking longer is cancelled, 0 lifts the limit
+	Timeout time.Duration `mapstructure:"timeout" validate:"gte=0"`
+}
+
+// JobsConfig configures the background job queue
+type JobsConfig struct {
+	// how often an idle worker looks for a job
+	PollInterval time.Duration `mapstructure:"pollInterval" validate:"gt=0"`
+	// how long a claimed job is hidden from the other workers, the lease is
+	// extended while the job runs
+	VisibilityTimeout time.Duration `mapstructure:"visibilityTimeout" validate:"gt=0"`
+	// attempts of a failing job before it is dead-lettered
+	MaxAttempts int `mapstructure:"maxAttempts" validate:"gt=0"`
+	// jobs of a kind a replica runs at once
+	Concurrency          int           `mapstructure:"concurrency" validate:"gt=0"`
+	RetryInitialInterval time.Duration `mapstructure:"retryInitialInterval" validate:"gt=0"`
+	RetryMaxInterval     time.Duration `mapstructure:"retryMaxInterval" validate:"gtefield=RetryInitialInterval"`
+}
+
+// ArticlesConfig configures the bulk article endpoints
+type ArticlesConfig struct {
+	// the most items a single batch request may carry
+	BatchMaxItems int `mapstructure:"batchMaxItems" validate:"gt=0"`
+	// how many rows go into one insert statement
+	BatchSize int `mapstructure:"batchSize" validate:"gt=0"`
+	// replaces postgres.statementTimeout for an export, 0 lifts the limit
+	ExportStatementTimeout time.Duration `mapstructure:"exportStatementTimeout" validate:"gte=0"`
+	// the largest file an import accepts
+	ImportMaxBytes int64 `mapstructure:"importMaxBytes" validate:"gt=0"`
+	// how many row errors an import job keeps, the others are only counted
+	ImportMaxErrors int `mapstructure:"importMaxErrors" validate:"gte=0"`
+	// how long a deleted article is kept before the purge task removes it
+	PurgeAfter time.Duration `mapstructure:"purgeAfter" validate:"gt=0"`
+}
+
+// AdminConfig guards the /api/v1/admin endpoints
+type AdminConfig struct {
+	// bearer token the admin endpoints expect, empty disables them
+	Token string `mapstructure:"token" secret:"true"`
+}
+
+// IdempotencyConfig configures the Idempotency-Key support of unsafe requests
+type IdempotencyConfig struct {
+	// how long a completed response is replayed
+	TTL time.Duration `mapstructure:"ttl" validate:"gt=0"`
+	// how long a request may hold its key before a retry can claim it
+	InFlightTTL  time.Duration `mapstructure:"inFlightTTL" validate:"gt=0"`
+	MaxBodyBytes int64         `mapstructure:"maxBodyBytes" validate:"gt=0"`
 }
 
 // PostgresConfig ...
 type PostgresConfig struct {
-	ConnMaxLifetime    int    `mapstructure:"connectTimeout"`
-	MaxOpenConnections int    `mapstructure:"maxOpenConnections"`
-	MaxIdleConnections int    `mapstructure:"maxIdleConnections"`
-	Host               string `mapstructure:"host"`
-	Port               string `mapstructure:"port"`
-	Schema             string `mapstructure:"schema"`
-	DBName             string `mapstructure:"dbName"`
-	User               string `mapstructure:"user"`
-	Password           string `mapstructure:"password"`
+	Host               string        `mapstructure:"host" validate:"required"`
+	Port               int           `mapstructure:"port" validate:"min=1,max=65535"`
+	DBName             string        `mapstructure:"dbName" validate:"required"`
+	User               string        `mapstructure:"user" validate:"required"`
+	Password           string        `mapstructure:"password" secret:"true"`
+	Schema             string        `mapstructure:"schema"`
+	SSLMode            string        `mapstructure:"sslMode" validate:"oneof=disable allow prefer require verify-ca verify-full"`
+	SSLRootCert        string        `mapstructure:"sslRootCert" validate:"omitempty,file"`
+	SSLCert            string        `mapstructure:"sslCert" validate:"required_with=SSLKey,omitempty,file"`
+	SSLKey             string        `mapstructure:"sslKey" validate:"required_with=SSLCert,omitempty,file"`
+	TimeZone           string        `mapstructure:"timeZone" validate:"omitempty,timezone"`
+	ApplicationName    string        `mapstructure:"applicationName"`
+	ConnectTimeout     time.Duration `mapstructure:"connectTimeout" validate:"gte=0"`
+	StatementTimeout   time.Duration `mapstructure:"statementTimeout" validate:"gte=0"`
+	ConnMaxLifetime    time.Duration `mapstructure:"connMaxLifetime" validate:"gte=0"`
+	ConnMaxIdleTime    time.Duration `mapstructure:"connMaxIdleTime" validate:"gte=0"`
+	MaxOpenConnections int           `mapstructure:"maxOpenConnections" validate:"gt=0"`
+	MaxIdleConnections int           `mapstructure:"maxIdleConnections" validate:"gt=0,ltefield=MaxOpenConnections"`
+	AutoMigrate        bool          `mapstructure:"autoMigrate"`
+	// read replicas as host:port, they share every other setting with the primary
+	Replicas             []string      `mapstructure:"replicas" validate:"dive,hostname_port"`
+	ReplicaCheckInterval time.Duration `mapstructure:"replicaCheckInterval" validate:"gt=0"`
+	ReadYourWritesWindow time.Duration `mapstructure:"readYourWritesWindow" validate:"gte=0"`
+	Breaker              BreakerConfig `mapstructure:"breaker"`
+}
+
+// RetryConfig bounds the exponential backoff used while connecting to the
+// dependencies at startup
+type RetryConfig struct {
+	MaxAttempts     int           `mapstructure:"maxAttempts" validate:"gt=0"`
+	InitialInterval time.Duration `mapstructure:"initialInterval" validate:"gt=0"`
+	MaxInterval     time.Duration `mapstructure:"maxInterval" validate:"gtefield=InitialInterval"`
+	MaxElapsed      time.Duration `mapstructure:"maxElapsed" validate:"gte=0"`
+}
+
+type CacheConfig struct {
+	ArticleTTL     time.Duration `mapstructure:"articleTTL" validate:"gt=0"`
+	ArticleListTTL time.Duration `mapstructure:"articleListTTL" validate:"gt=0"`
+	// how long an unknown article id is remembered, zero disables it
+	ArticleNotFoundTTL time.Duration `mapstructure:"articleNotFoundTTL" validate:"gte=0"`
+	// how long a readiness report is reused, zero runs the checks every time
+	HealthTTL time.Duration `mapstructure:"healthTTL" validate:"gte=0"`
+	Codec     string        `mapstructure:"codec" validate:"oneof=json msgpack"`
+	// cache writes allowed to run in the background at once
+	MaxPendingWrites int `mapstructure:"maxPendingWrites" validate:"gt=0"`
+	// how long an expired entry is still served while it is refreshed
+	StaleTTL time.Duration `mapstructure:"staleTTL" validate:"gte=0"`
+	// take a redis lock so only one replica loads a missing key, it needs
+	// redis.enableRedis
+	Lock    bool          `mapstructure:"lock"`
+	LockTTL time.Duration `mapstructure:"lockTTL" validate:"gt=0"`
+	// list pages the warm cache task loads ahead of the readers
+	WarmPages int `mapstructure:"warmPages" validate:"gt=0"`
+	// in-process tier, standalone without redis or as L1 in front of it
+	Local LocalCacheConfig `mapstructure:"local"`
+}
+
+type LocalCacheConfig struct {
+	Enabled    bool `mapstructure:"enabled"`
+	MaxEntries int  `mapstructure:"maxEntries" validate:"required_if=Enabled true,gte=0"`
+	// caps how long an L1 copy of a redis entry lives, it bounds staleness
+	// when an invalidation message is lost
+	TTL                 time.Duration `mapstructure:"ttl" validate:"required_if=Enabled true,gte=0"`
+	InvalidationChannel string        `mapstructure:"invalidationChannel" validate:"required_if=Enabled true"`
 }
 
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeSentinel   = "sentinel"
+	RedisModeCluster    = "cluster"
+)
+
 type RedisConfig struct {
-	Host        string `mapstructure:"host"`
-	Password    string `mapstructure:"password"`
-	DB          int    `mapstructure:"db"`
-	Port        int    `mapstructure:"port"`
+	// standalone connects to host and port, sentinel and cluster use addrs
+	Mode        string `mapstructure:"mode" validate:"oneof=standalone sentinel cluster"`
+	Host        string `mapstructure:"host" validate:"required_if=EnableRedis true Mode standalone"`
+	Password    string `mapstructure:"password" secret:"true"`
+	DB          int    `mapstructure:"db" validate:"gte=0,excluded_if=Mode cluster"`
+	Port        int    `mapstructure:"port" validate:"required_if=EnableRedis true Mode standalone,gte=0,max=65535"`
 	EnableRedis bool   `mapstructure:"enableRedis"`
+	// the sentinel addresses, or the cluster seed nodes
+	Addrs []string `mapstructure:"addrs" validate:"dive,hostname_port"`
+	// the master monitored by the sentinels
+	MasterName string `mapstructure:"masterName" validate:"required_if=Mode sentinel"`
+	// 0 keeps the go-redis default of 10 connections per cpu
+	PoolSize     int            `mapstructure:"poolSize" validate:"gte=0"`
+	DialTimeout  time.Duration  `mapstructure:"dialTimeout" validate:"gt=0"`
+	ReadTimeout  time.Duration  `mapstructure:"readTimeout" validate:"gt=0"`
+	WriteTimeout time.Duration  `mapstructure:"writeTimeout" validate:"gt=0"`
+	TLS          RedisTLSConfig `mapstructure:"tls"`
+	Breaker      BreakerConfig  `mapstructure:"breaker"`
+}
+
+// RedisTLSConfig enables TLS on every redis connection, sentinels included
+type RedisTLSConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// verifies the server against this CA bundle instead of the system pool
+	CAFile string `mapstructure:"caFile" validate:"omitempty,file"`
+	// overrides the name checked against the server certificate
+	ServerName         string `mapstructure:"serverName"`
+	InsecureSkipVerify bool   `mapstructure:"insecureSkipVerify"`
+}
+
+// BreakerConfig configures the circuit breaker around a dependency
+type BreakerConfig struct {
+	FailureThreshold  int           `mapstructure:"failureThreshold" validate:"gt=0"`
+	OpenTimeout       time.Duration `mapstructure:"openTimeout" validate:"gt=0"`
+	HalfOpenMaxCalls  int           `mapstructure:"halfOpenMaxCalls" validate:"gt=0"`
+	SlowCallThreshold time.Duration `mapstructure:"slowCallThreshold" validate:"gte=0"`
 }
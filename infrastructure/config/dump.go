@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+const maskedValue = "******"
+
+// Dump returns the config as a nested map keyed like the config file, every
+// field tagged `secret:"true"` is masked when it is not empty.
+func (c Config) Dump() map[string]interface{} {
+	return dumpStruct(reflect.ValueOf(c))
+}
+
+// String keeps secrets out of logs when the config is printed with %v
+func (c Config) String() string {
+	return fmt.Sprint(c.Dump())
+}
+
+func (c PostgresConfig) String() string {
+	return fmt.Sprint(dumpStruct(reflect.ValueOf(c)))
+}
+
+func (c RedisConfig) String() string {
+	return fmt.Sprint(dumpStruct(reflect.ValueOf(c)))
+}
+
+func dumpStruct(v reflect.Value) map[string]interface{} {
+	out := make(map[string]interface{}, v.NumField())
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+		value := v.Field(i)
+		switch {
+		case value.Kind() == reflect.Struct:
+			out[key] = dumpStruct(value)
+		case field.Tag.Get("secret") == "true" && !value.IsZero():
+			out[key] = maskedValue
+		case value.Type() == reflect.TypeOf(time.Duration(0)):
+			out[key] = value.Interface().(time.Duration).String()
+		default:
+			out[key] = value.Interface()
+		}
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Keys returns every config key in viper notation, e.g. postgres.password
+func Keys() []string {
+	return collectKeys(reflect.TypeOf(Config{}), "")
+}
+
+// EnvVar returns the environment variable that overrides key
+func EnvVar(key string) string {
+	return envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+func collectKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if field.Type.Kind() == reflect.Struct && field.Type.PkgPath() != "time" {
+			keys = append(keys, collectKeys(field.Type, name)...)
+			continue
+		}
+		keys = append(keys, name)
+	}
+	return keys
+}
+
+// lookup returns the settable field of conf addressed by key
+func lookup(conf *Config, key string) (reflect.Value, bool) {
+	value := reflect.ValueOf(conf).Elem()
+	for _, name := range strings.Split(key, ".") {
+		found := false
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).Tag.Get("mapstructure") == name {
+				value = value.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return reflect.Value{}, false
+		}
+	}
+	return value, true
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	sourceNone = iota
+	sourceFile
+	sourceRemote
+)
+
+// reloadableKeys is the whitelist of keys that are applied without a
+// restart, changes to any other key are logged and ignored
+var reloadableKeys = []string{
+	"logLevel",
+	"rate",
+	"interval",
+	"cache.articleTTL",
+	"cache.articleListTTL",
+	"cache.articleNotFoundTTL",
+}
+
+type watchState struct {
+	viper  *viper.Viper
+	source int
+}
+
+var (
+	// current holds the latest accepted config, Conf keeps the values the
+	// process booted with and is never written after Initialize
+	current atomic.Pointer[Config]
+	watched watchState
+
+	reloadMu  sync.Mutex
+	listeners []func(old, new Config)
+)
+
+// Current returns the latest config including the hot reloaded keys, it is
+// safe to call from any goroutine
+func Current() Config {
+	if conf := current.Load(); conf != nil {
+		return *conf
+	}
+	return Conf
+}
+
+// OnReload registers fn to be called after every accepted reload
+func OnReload(fn func(old, new Config)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	listeners = append(listeners, fn)
+}
+
+// Watch reloads the config whenever the config file changes, or by polling
+// the remote provider, until ctx is done
+func Watch(ctx context.Context) {
+	v := watched.viper
+	if v == nil {
+		return
+	}
+
+	switch watched.source {
+	case sourceFile:
+		v.OnConfigChange(func(event fsnotify.Event) {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Infof("config file %s changed, reloading", event.Name)
+			reload(v)
+		})
+		v.WatchConfig()
+		<-ctx.Done()
+	case sourceRemote:
+		ticker := time.NewTicker(Current().RemotePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				reloadMu.Lock()
+				err := v.WatchRemoteConfig()
+				reloadMu.Unlock()
+				if err != nil {
+					log.Warnf("config reload: failed polling remote provider: %v", err)
+					continue
+				}
+				reload(v)
+			}
+		}
+	default:
+		log.Info("config reload: no config file or remote provider to watch")
+	}
+}
+
+func reload(v *viper.Viper) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	next, err := load(v)
+	if err != nil {
+		var validationErr ValidationError
+		if errors.As(err, &validationErr) {
+			log.Errorf("config reload rejected, %v", validationErr)
+			return
+		}
+		log.Errorf("config reload rejected: %v", err)
+		return
+	}
+
+	old := Current()
+	merged := old
+	changed := false
+	for _, key := range Keys() {
+		oldValue, _ := lookup(&old, key)
+		nextValue, _ := lookup(&next, key)
+		if reflect.DeepEqual(oldValue.Interface(), nextValue.Interface()) {
+			continue
+		}
+		if !isReloadable(key) {
+			log.Warnf("config reload: %s changed but requires a restart, ignoring", key)
+			continue
+		}
+		target, _ := lookup(&merged, key)
+		target.Set(nextValue)
+		changed = true
+		if isSecret(key) {
+			log.Infof("config reload: %s changed", key)
+			continue
+		}
+		log.Infof("config reload: %s changed from %v to %v", key, oldValue.Interface(), nextValue.Interface())
+	}
+	if !changed {
+		return
+	}
+
+	current.Store(&merged)
+	for _, fn := range listeners {
+		fn(old, merged)
+	}
+}
+
+func isReloadable(key string) bool {
+	for _, reloadable := range reloadableKeys {
+		if key == reloadable {
+			return true
+		}
+	}
+	return false
+}
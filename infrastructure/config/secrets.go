@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// interpolationRegex matches ${NAME} and ${NAME:-default}
+var interpolationRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// resolveSecrets applies the `<ENV>_FILE` indirection and the `${ENV}`
+// interpolation to the raw settings in place. It returns a problem per key
+// that could not be resolved, together with that key.
+func resolveSecrets(settings map[string]interface{}) (problems []string, failedKeys []string) {
+	for _, key := range Keys() {
+		envVar := EnvVar(key)
+		if path := os.Getenv(envVar + "_FILE"); path != "" {
+			if _, ok := os.LookupEnv(envVar); ok {
+				problems = append(problems, fmt.Sprintf("%s is set by both %s and %s_FILE", key, envVar, envVar))
+				failedKeys = append(failedKeys, key)
+				continue
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s could not be read from %s_FILE: %v", key, envVar, err))
+				failedKeys = append(failedKeys, key)
+				continue
+			}
+			setSetting(settings, key, strings.TrimRight(string(content), "\r\n"))
+			continue
+		}
+
+		value, ok := getSetting(settings, key).(string)
+		if !ok || !strings.Contains(value, "${") {
+			continue
+		}
+		resolved, err := interpolate(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s %v", key, err))
+			failedKeys = append(failedKeys, key)
+			continue
+		}
+		setSetting(settings, key, resolved)
+	}
+	return problems, failedKeys
+}
+
+func interpolate(value string) (string, error) {
+	var missing []string
+	resolved := interpolationRegex.ReplaceAllStringFunc(value, func(match string) string {
+		parts := interpolationRegex.FindStringSubmatch(match)
+		if env, ok := os.LookupEnv(parts[1]); ok {
+			return env
+		}
+		if parts[2] != "" {
+			return parts[3]
+		}
+		missing = append(missing, parts[1])
+		return match
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("references undefined environment variable(s) %s", strings.Join(missing, ", "))
+	}
+	return resolved, nil
+}
+
+// getSetting and setSetting address the nested settings map of viper,
+// whose keys are lower cased
+func getSetting(settings map[string]interface{}, key string) interface{} {
+	segments := strings.Split(strings.ToLower(key), ".")
+	for _, segment := range segments[:len(segments)-1] {
+		next, ok := settings[segment].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		settings = next
+	}
+	return settings[segments[len(segments)-1]]
+}
+
+func setSetting(settings map[string]interface{}, key string, value interface{}) {
+	segments := strings.Split(strings.ToLower(key), ".")
+	for _, segment := range segments[:len(segments)-1] {
+		next, ok := settings[segment].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			settings[segment] = next
+		}
+		settings = next
+	}
+	settings[segments[len(segments)-1]] = value
+}
+
+// isSecret reports whether the field addressed by key is tagged
+// `secret:"true"`
+func isSecret(key string) bool {
+	t := reflect.TypeOf(Config{})
+	var field reflect.StructField
+	for _, name := range strings.Split(key, ".") {
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).Tag.Get("mapstructure") == name {
+				field = t.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+		t = field.Type
+	}
+	return field.Tag.Get("secret") == "true"
+}
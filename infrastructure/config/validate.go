@@ -0,0 +1,186 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go-bunrouter-gorm-example/utils"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/mitchellh/mapstructure"
+)
+
+var validate = newValidator()
+
+// ValidationError holds every problem found in the config
+type ValidationError struct {
+	Problems []string
+	// Keys holds the config key of each problem found by Validate
+	Keys []string
+}
+
+func (e ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	// report the config key instead of the go field name
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return field.Tag.Get("mapstructure")
+	})
+	v.RegisterStructValidation(validateRedis, RedisConfig{})
+	v.RegisterStructValidation(validateCacheLock, Config{})
+	_ = v.RegisterValidation("cron", func(fl validator.FieldLevel) bool {
+		_, err := utils.ParseCron(fl.Field().String())
+		return err == nil
+	})
+	return v
+}
+
+// validateRedis requires addrs outside standalone mode, the required_unless
+// tag would accept the empty list a yaml `addrs: []` decodes to
+func validateRedis(sl validator.StructLevel) {
+	conf := sl.Current().Interface().(RedisConfig)
+	if conf.Mode != RedisModeStandalone && len(conf.Addrs) == 0 {
+		sl.ReportError(conf.Addrs, "addrs", "Addrs", "required_unless", "Mode standalone")
+	}
+}
+
+// validateCacheLock rejects cache.lock without redis, every replica then
+// caches in its own memory and a winner never fills the cache the others
+// wait on
+func validateCacheLock(sl validator.StructLevel) {
+	conf := sl.Current().Interface().(Config)
+	if conf.Cache.Lock && !conf.Redis.EnableRedis {
+		sl.ReportError(conf.Cache.Lock, "cache.lock", "Cache.Lock", "requires_redis", "")
+	}
+}
+
+// Validate checks the config against the `validate` tags of its fields
+func (c Config) Validate() error {
+	err := validate.Struct(c)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err
+	}
+
+	result := ValidationError{}
+	for _, fieldErr := range validationErrors {
+		// the namespace starts with the struct name, e.g. Config.postgres.host
+		key := fieldErr.Namespace()
+		if dot := strings.Index(key, "."); dot >= 0 {
+			key = key[dot+1:]
+		}
+		result.Keys = append(result.Keys, key)
+		result.Problems = append(result.Problems, describe(key, fieldErr))
+	}
+	return result
+}
+
+func describe(key string, fieldErr validator.FieldError) string {
+	value := fieldErr.Value()
+	if isSecret(key) {
+		value = maskedValue
+	}
+
+	param := fieldErr.Param()
+	if fieldErr.Kind() == reflect.Int64 && fieldErr.Type() == reflect.TypeOf(time.Duration(0)) {
+		if d, err := time.ParseDuration(param + "ns"); err == nil {
+			param = d.String()
+		}
+	}
+
+	switch fieldErr.Tag() {
+	case "required", "required_if":
+		return fmt.Sprintf("%s is required", key)
+	case "required_unless":
+		return fmt.Sprintf("%s is required unless %s is %s", key, siblingKey(key, fieldErr), conditionValue(fieldErr))
+	case "excluded_if":
+		return fmt.Sprintf("%s must not be set when %s is %s, got %v", key, siblingKey(key, fieldErr), conditionValue(fieldErr), value)
+	case "required_with":
+		return fmt.Sprintf("%s is required when %s is set", key, siblingKey(key, fieldErr))
+	case "requires_redis":
+		return fmt.Sprintf("%s needs redis.enableRedis, the caches of the replicas are not shared without it", key)
+	case "file":
+		return fmt.Sprintf("%s must point to an existing file, got %q", key, value)
+	case "hostname_port":
+		return fmt.Sprintf("%s must be a host:port address, got %q", key, value)
+	case "timezone":
+		return fmt.Sprintf("%s must be a valid IANA time zone, got %q", key, value)
+	case "cron":
+		return fmt.Sprintf("%s must be a five field cron expression such as \"*/5 * * * *\", got %q", key, value)
+	case "min", "gte":
+		return fmt.Sprintf("%s must be at least %s, got %v", key, param, value)
+	case "max", "lte":
+		return fmt.Sprintf("%s must be at most %s, got %v", key, param, value)
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s, got %v", key, param, value)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of [%s], got %q", key, param, value)
+	case "gtefield":
+		return fmt.Sprintf("%s must not be less than %s, got %v", key, siblingKey(key, fieldErr), value)
+	case "ltefield":
+		return fmt.Sprintf("%s must not be greater than %s, got %v", key, siblingKey(key, fieldErr), value)
+	default:
+		return fmt.Sprintf("%s failed the %s rule", key, fieldErr.Tag())
+	}
+}
+
+// siblingKey resolves the go field name used as a rule parameter, e.g. by
+// ltefield or as the condition of required_unless, to its config key
+func siblingKey(key string, fieldErr validator.FieldError) string {
+	name, _, _ := strings.Cut(fieldErr.Param(), " ")
+	parent := reflect.TypeOf(Config{})
+	segments := strings.Split(fieldErr.StructNamespace(), ".")
+	for _, segment := range segments[1 : len(segments)-1] {
+		field, ok := parent.FieldByName(segment)
+		if !ok {
+			return name
+		}
+		parent = field.Type
+	}
+	sibling, ok := parent.FieldByName(name)
+	if !ok {
+		return name
+	}
+	if dot := strings.LastIndex(key, "."); dot >= 0 {
+		return key[:dot+1] + sibling.Tag.Get("mapstructure")
+	}
+	return sibling.Tag.Get("mapstructure")
+}
+
+// conditionValue is the value compared by a conditional rule such as
+// required_unless=Mode standalone
+func conditionValue(fieldErr validator.FieldError) string {
+	_, value, _ := strings.Cut(fieldErr.Param(), " ")
+	return value
+}
+
+// durationDecodeHook parses duration fields with utils.ParseDuration. Bare
+// numbers are rejected because their unit would be ambiguous.
+func durationDecodeHook() mapstructure.DecodeHookFuncType {
+	durationType := reflect.TypeOf(time.Duration(0))
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+		if to != durationType {
+			return data, nil
+		}
+		switch from.Kind() {
+		case reflect.String:
+			return utils.ParseDuration(data.(string))
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return nil, fmt.Errorf("duration %v has no unit, use a value such as \"15s\" or \"1m\"", data)
+		default:
+			return data, nil
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/redis"
+)
+
+// checkAdvisoryLock tells whether the session still holds the bigint
+// advisory lock $1, postgres stores its high and low halves apart
+const checkAdvisoryLock = `select exists (
+	select 1 from pg_locks
+	where locktype = 'advisory' and pid = pg_backend_pid() and granted and objsubid = 1
+	and ((classid::bigint << 32) | objid::bigint) = $1
+)`
+
+type advisoryLocker struct {
+	db *sql.DB
+}
+
+// NewAdvisoryLocker returns a Locker built on postgres session advisory
+// locks, used when redis is disabled. A lock pins one pooled connection until
+// it is released and has no lease: it is held until Release or until its
+// connection dies, the ttl only has to be positive.
+func NewAdvisoryLocker(db *sql.DB) redis.Locker {
+	return advisoryLocker{db: db}
+}
+
+// advisoryKey maps a lock name onto the bigint key space of advisory locks
+func advisoryKey(name string) int64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte("lock:" + name))
+	return int64(hash.Sum64())
+}
+
+func (l advisoryLocker) TryAcquire(ctx context.Context, name string, ttl time.Duration) (redis.Lock, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("lock %s: ttl must be greater than 0, got %s", name, ttl)
+	}
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("acquire lock %s: %w", name, err)
+	}
+
+	key := advisoryKey(name)
+	var acquired bool
+	if err = conn.QueryRowContext(ctx, `select pg_try_advisory_lock($1)`, key).Scan(&acquired); err != nil {
+		discard(conn)
+		return nil, fmt.Errorf("acquire lock %s: %w", name, err)
+	}
+	if !acquired {
+		conn.Close()
+		return nil, redis.ErrLockHeld
+	}
+	return &advisoryLock{conn: conn, name: name, key: key, token: redis.NewToken()}, nil
+}
+
+// discard closes the connection instead of handing it back to the pool, a
+// session that may still hold a lock must not be reused
+func discard(conn *sql.Conn) {
+	_ = conn.Raw(func(interface{}) error {
+		return driver.ErrBadConn
+	})
+	conn.Close()
+}
+
+type advisoryLock struct {
+	mu    sync.Mutex
+	conn  *sql.Conn
+	name  string
+	key   int64
+	token string
+}
+
+func (l *advisoryLock) Name() string {
+	return l.name
+}
+
+func (l *advisoryLock) Token() string {
+	return l.token
+}
+
+// Refresh checks that the session still holds the lock, a dropped
+// connection loses it
+func (l *advisoryLock) Refresh(ctx context.Context, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return redis.ErrLockLost
+	}
+
+	var held bool
+	err := l.conn.QueryRowContext(ctx, checkAdvisoryLock, l.key).Scan(&held)
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("refresh lock %s: %w", l.name, err)
+	}
+	if err != nil {
+		// the server drops the lock with the session
+		discard(l.conn)
+		l.conn = nil
+		return redis.ErrLockLost
+	}
+	if !held {
+		l.conn.Close()
+		l.conn = nil
+		return redis.ErrLockLost
+	}
+	return nil
+}
+
+func (l *advisoryLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return redis.ErrLockLost
+	}
+	conn := l.conn
+	l.conn = nil
+
+	var released bool
+	if err := conn.QueryRowContext(ctx, `select pg_advisory_unlock($1)`, l.key).Scan(&released); err != nil {
+		discard(conn)
+		return fmt.Errorf("release lock %s: %w", l.name, err)
+	}
+	conn.Close()
+	if !released {
+		return redis.ErrLockLost
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// migrationLockID is the key of the advisory lock that serialises
+	// migrations across every replica sharing the database
+	migrationLockID int64 = 7_364_289_511
+
+	createSchemaMigrationsTable = `create table if not exists schema_migrations (
+	version bigint primary key,
+	name varchar(255) not null,
+	applied_at timestamptz not null default now()
+)`
+)
+
+var (
+	ErrMigrationNotFound  = errors.New("migration file not found")
+	ErrInvalidMigration   = errors.New("invalid migration file name")
+	ErrNoMigrationApplied = errors.New("no migration has been applied")
+
+	migrationFileRegex = regexp.MustCompile(`^(\d+)_([\w-]+)\.(up|down)\.sql$`)
+	migrationNameRegex = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator loads every migration from fsys, usually migrations.FS
+func NewMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		match := migrationFileRegex.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, entry.Name())
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("%w: version %d is used by %s and %s", ErrInvalidMigration, version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("%w: version %d has no up file", ErrInvalidMigration, migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// withLock runs fn on a single connection holding the migration advisory
+// lock, session level advisory locks belong to the connection that took them
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, `select pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// use a fresh context, the lock must be released even if ctx is done
+		if _, errUnlock := conn.ExecContext(context.Background(), `select pg_advisory_unlock($1)`, migrationLockID); errUnlock != nil {
+			log.Errorf("release migration lock: %v", errUnlock)
+		}
+	}()
+
+	if _, err = conn.ExecContext(ctx, createSchemaMigrationsTable); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `select version, applied_at from schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Up applies every pending migration in version order, each one in its own
+// transaction
+func (m *Migrator) Up(ctx context.Context) (applied []Migration, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			err = runInTx(ctx, conn, migration.Up,
+				`insert into schema_migrations (version, name) values ($1, $2)`, migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			log.Infof("applied migration %d_%s", migration.Version, migration.Name)
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the latest `steps` applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) (reverted []Migration, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			return ErrNoMigrationApplied
+		}
+
+		versions := make([]int64, 0, len(done))
+		for version := range done {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i] > versions[j]
+		})
+		if steps > 0 && steps < len(versions) {
+			versions = versions[:steps]
+		}
+
+		for _, version := range versions {
+			migration, ok := m.find(version)
+			if !ok || migration.Down == "" {
+				return fmt.Errorf("%w: down file for version %d", ErrMigrationNotFound, version)
+			}
+			err = runInTx(ctx, conn, migration.Down,
+				`delete from schema_migrations where version = $1`, migration.Version)
+			if err != nil {
+				return fmt.Errorf("revert migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			log.Infof("reverted migration %d_%s", migration.Version, migration.Name)
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+func (m *Migrator) Status(ctx context.Context) (status []MigrationStatus, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			row := MigrationStatus{
+				Version: migration.Version,
+				Name:    migration.Name,
+			}
+			if appliedAt, ok := done[migration.Version]; ok {
+				row.Applied = true
+				row.AppliedAt = &appliedAt
+			}
+			status = append(status, row)
+		}
+		return nil
+	})
+	return status, err
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+func runInTx(ctx context.Context, conn *sql.Conn, script string, bookkeeping string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateMigration writes an empty up/down pair to dir using the next free
+// version number
+func CreateMigration(dir, name string) (upPath, downPath string, err error) {
+	name = strings.Trim(migrationNameRegex.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", fmt.Errorf("%w: empty name", ErrInvalidMigration)
+	}
+
+	migrations, err := loadMigrations(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	var next int64 = 1
+	if len(migrations) > 0 {
+		next = migrations[len(migrations)-1].Version + 1
+	}
+
+	base := fmt.Sprintf("%06d_%s", next, name)
+	upPath = filepath.Join(dir, base+".up.sql")
+	downPath = filepath.Join(dir, base+".down.sql")
+	if err = os.WriteFile(upPath, []byte("-- write the up migration here\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	if err = os.WriteFile(downPath, []byte("-- write the down migration here\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	return upPath, downPath, nil
+}
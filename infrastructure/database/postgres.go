@@ -1,9 +1,14 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"errors"
 	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
 	"time"
 
 	"go-bunrouter-gorm-example/infrastructure/config"
@@ -16,58 +21,175 @@ import (
 )
 
 const (
-	defaultConnMaxLifeTime int = 5  // default max 5 minutes lifetime
-	defaultMaxOpenConns    int = 10 // default max 10 open connections
-	defaultMaxIdleConns    int = 10 // default max 10 idle connections
+	defaultConnMaxLifeTime     = 5 * time.Minute // default max 5 minutes lifetime
+	defaultMaxOpenConns    int = 10              // default max 10 open connections
+	defaultMaxIdleConns    int = 10              // default max 10 idle connections
 )
 
 type HandlerDatabase struct {
-	DbConn *gorm.DB
+	DbConn   *gorm.DB
+	Resolver *Resolver
 }
 
 func NewDatabaseClient(conf *config.Config) (HandlerDatabase, error) {
-	db := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s fallback_application_name=go-soskomlap-api-master TimeZone=Asia/Jakarta",
-		conf.Postgres.Host,
-		conf.Postgres.Port,
-		conf.Postgres.User,
-		conf.Postgres.Password,
-		conf.Postgres.DBName,
-		"disable")
-	dbConn, err := loadPsqlDb(conf.LogMode, db, conf.Postgres.MaxOpenConnections, conf.Postgres.MaxIdleConnections, conf.Postgres.ConnMaxLifetime)
+	dbConn, err := loadPsqlDb(conf.LogMode, BuildDSN(conf.Postgres), conf.Postgres, true)
 	if err != nil {
 		log.Printf("failed to connect database instance: %v", err)
 		return HandlerDatabase{}, err
 	}
 
+	//a replica that is down at boot is only marked unhealthy, reads fall
+	//back to the primary until it comes back
+	replicas := make([]*replica, 0, len(conf.Postgres.Replicas))
+	for _, address := range conf.Postgres.Replicas {
+		replicaConf, err := replicaConfig(conf.Postgres, address)
+		if err != nil {
+			return HandlerDatabase{}, err
+		}
+		replicaConn, err := loadPsqlDb(conf.LogMode, BuildDSN(replicaConf), replicaConf, false)
+		if err != nil {
+			log.Printf("failed to open database replica %s: %v", address, err)
+			return HandlerDatabase{}, err
+		}
+		r := &replica{name: address, db: replicaConn}
+		if err = r.ping(context.Background()); err != nil {
+			log.Printf("database replica %s is not reachable yet: %v", address, err)
+		}
+		replicas = append(replicas, r)
+	}
+
 	return HandlerDatabase{
-		DbConn: dbConn,
+		DbConn:   dbConn,
+		Resolver: NewResolver(dbConn, replicas, conf.Postgres.ReadYourWritesWindow),
 	}, nil
 }
 
-func loadPsqlDb(logMode bool, psqlInfo string, maxOpenConn, maxIdleConn, maxLifetime int) (*gorm.DB, error) {
+// replicaConfig derives the config of a replica from the primary config,
+// only host and port differ
+func replicaConfig(primary config.PostgresConfig, address string) (config.PostgresConfig, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return config.PostgresConfig{}, err
+	}
+	replicaConf := primary
+	replicaConf.Host = host
+	replicaConf.Port, err = strconv.Atoi(port)
+	if err != nil {
+		return config.PostgresConfig{}, err
+	}
+	replicaConf.Replicas = nil
+	return replicaConf, nil
+}
+
+type dsnParam struct {
+	key   string
+	value string
+}
+
+// BuildDSN builds a lib/pq key=value connection string, the keys that are
+// not understood by lib/pq itself (TimeZone, search_path, statement_timeout)
+// are sent to the server as run-time parameters
+func BuildDSN(conf config.PostgresConfig) string {
+	params := []dsnParam{
+		{"host", conf.Host},
+		{"port", strconv.Itoa(conf.Port)},
+		{"user", conf.User},
+		{"password", conf.Password},
+		{"dbname", conf.DBName},
+		{"sslmode", conf.SSLMode},
+		{"sslrootcert", conf.SSLRootCert},
+		{"sslcert", conf.SSLCert},
+		{"sslkey", conf.SSLKey},
+		{"application_name", conf.ApplicationName},
+		{"TimeZone", conf.TimeZone},
+		{"search_path", conf.Schema},
+	}
+	if conf.ConnectTimeout > 0 {
+		// connect_timeout only has a second resolution, round up so a sub
+		// second timeout does not turn into "wait forever"
+		seconds := int64(math.Ceil(conf.ConnectTimeout.Seconds()))
+		params = append(params, dsnParam{"connect_timeout", strconv.FormatInt(seconds, 10)})
+	}
+	if conf.StatementTimeout > 0 {
+		params = append(params, dsnParam{"statement_timeout", strconv.FormatInt(conf.StatementTimeout.Milliseconds(), 10)})
+	}
+
+	parts := make([]string, 0, len(params))
+	for _, param := range params {
+		if param.value == "" {
+			continue
+		}
+		parts = append(parts, param.key+"="+quoteDSNValue(param.value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteDSNValue quotes a value for a key=value connection string when it is
+// empty or contains spaces, quotes or backslashes
+func quoteDSNValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+// Close closes the replicas and then the primary sql.DB pool
+func (h HandlerDatabase) Close() error {
+	if h.DbConn == nil {
+		return nil
+	}
+	var errs []error
+	if h.Resolver != nil {
+		for _, r := range h.Resolver.replicas {
+			errs = append(errs, closeGorm(r.db))
+		}
+	}
+	errs = append(errs, closeGorm(h.DbConn))
+	return errors.Join(errs...)
+}
+
+func closeGorm(db *gorm.DB) error {
+	conn, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func loadPsqlDb(logMode bool, psqlInfo string, pool config.PostgresConfig, ping bool) (*gorm.DB, error) {
 	conn, err := sql.Open("postgres", psqlInfo)
 	if err != nil {
 		return nil, err
 	}
 	// checking if connection to db has been established
-	err = conn.Ping()
-	if err != nil {
-		return nil, err
+	if ping {
+		err = conn.Ping()
+		if err != nil {
+			// the pool is discarded, a retry opens a new one
+			_ = conn.Close()
+			return nil, err
+		}
 	}
 
+	maxLifetime := pool.ConnMaxLifetime
 	if maxLifetime == 0 {
 		maxLifetime = defaultConnMaxLifeTime
 	}
 
+	maxIdleConn := pool.MaxIdleConnections
 	if maxIdleConn == 0 {
 		maxIdleConn = defaultMaxIdleConns
 	}
 
+	maxOpenConn := pool.MaxOpenConnections
 	if maxOpenConn == 0 {
 		maxOpenConn = defaultMaxOpenConns
 	}
 
-	conn.SetConnMaxLifetime(time.Duration(maxLifetime) * time.Minute)
+	conn.SetConnMaxLifetime(maxLifetime)
+	conn.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
 	conn.SetMaxOpenConns(maxOpenConn)
 	conn.SetMaxIdleConns(maxIdleConn)
 
@@ -94,6 +216,8 @@ func loadPsqlDb(logMode bool, psqlInfo string, maxOpenConn, maxIdleConn, maxLife
 		}
 	}
 
+	gormConfig.DisableAutomaticPing = !ping
+
 	return gorm.Open(postgres.New(postgres.Config{
 		Conn: conn,
 	}), gormConfig)
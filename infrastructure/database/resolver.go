@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrReplicaNotFound = errors.New("database replica not found")
+)
+
+type ctxKeyPinPrimary struct{}
+
+// WithPrimary pins every read made with the returned context to the primary
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeyPinPrimary{}, true)
+}
+
+// IsPinnedToPrimary reports whether ctx was created by WithPrimary
+func IsPinnedToPrimary(ctx context.Context) bool {
+	pinned, _ := ctx.Value(ctxKeyPinPrimary{}).(bool)
+	return pinned
+}
+
+type replica struct {
+	name    string
+	db      *gorm.DB
+	healthy atomic.Bool
+}
+
+func (r *replica) ping(ctx context.Context) error {
+	conn, err := r.db.DB()
+	if err != nil {
+		r.healthy.Store(false)
+		return err
+	}
+	err = conn.PingContext(ctx)
+	r.healthy.Store(err == nil)
+	return err
+}
+
+// Resolver routes writes to the primary and reads to the healthy replicas
+// in round robin, reads fall back to the primary when no replica is healthy
+// or the context is pinned to the primary
+type Resolver struct {
+	primary              *gorm.DB
+	replicas             []*replica
+	next                 atomic.Uint64
+	readYourWritesWindow time.Duration
+}
+
+func NewResolver(primary *gorm.DB, replicas []*replica, readYourWritesWindow time.Duration) *Resolver {
+	return &Resolver{
+		primary:              primary,
+		replicas:             replicas,
+		readYourWritesWindow: readYourWritesWindow,
+	}
+}
+
+// Writer returns the primary bound to ctx
+func (r *Resolver) Writer(ctx context.Context) *gorm.DB {
+	return r.primary.WithContext(ctx)
+}
+
+// Reader returns a healthy replica bound to ctx, or the primary
+func (r *Resolver) Reader(ctx context.Context) *gorm.DB {
+	if len(r.replicas) == 0 || IsPinnedToPrimary(ctx) {
+		return r.primary.WithContext(ctx)
+	}
+
+	start := r.next.Add(1)
+	for i := 0; i < len(r.replicas); i++ {
+		candidate := r.replicas[(start+uint64(i))%uint64(len(r.replicas))]
+		if candidate.healthy.Load() {
+			return candidate.db.WithContext(ctx)
+		}
+	}
+	return r.primary.WithContext(ctx)
+}
+
+// Replicas returns the address of every configured replica
+func (r *Resolver) Replicas() []string {
+	names := make([]string, 0, len(r.replicas))
+	for _, replica := range r.replicas {
+		names = append(names, replica.name)
+	}
+	return names
+}
+
+// CheckReplica pings the replica and records the outcome for the routing
+func (r *Resolver) CheckReplica(ctx context.Context, name string) error {
+	for _, replica := range r.replicas {
+		if replica.name == name {
+			return replica.ping(ctx)
+		}
+	}
+	return ErrReplicaNotFound
+}
+
+// Run pings every replica on each interval until ctx is done, so routing
+// notices a replica coming back even without readiness probes
+func (r *Resolver) Run(ctx context.Context, interval time.Duration) {
+	if len(r.replicas) == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, replica := range r.replicas {
+				pingCtx, cancel := context.WithTimeout(ctx, interval)
+				_ = replica.ping(pingCtx)
+				cancel()
+			}
+		}
+	}
+}
+
+// ReadYourWritesWindow is how long a client stays pinned to the primary
+// after a write, zero disables the pinning
+func (r *Resolver) ReadYourWritesWindow() time.Duration {
+	return r.readYourWritesWindow
+}
@@ -0,0 +1,110 @@
+package idempotency
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/cache"
+	"go-bunrouter-gorm-example/infrastructure/redis"
+)
+
+const (
+	keyPrefix = "idempotency:"
+
+	StateInFlight  = "in_flight"
+	StateCompleted = "completed"
+
+	defaultTTL         = 24 * time.Hour
+	defaultInFlightTTL = time.Minute
+	memoryMaxEntries   = 10_000
+)
+
+var ErrRecordNotFound = errors.New("idempotency record not found")
+
+// Record is what is stored under an idempotency key, the fingerprint of the
+// request that claimed it and, once completed, the full response
+type Record struct {
+	State       string      `json:"state"`
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// Store keeps the idempotency records in redis, or in memory when redis is
+// disabled or its circuit breaker is open
+type Store struct {
+	redis       redis.LibInterface
+	memory      *cache.LRU
+	ttl         time.Duration
+	inFlightTTL time.Duration
+}
+
+// NewStore keeps completed records for ttl, a claim that is never completed
+// expires after inFlightTTL so a crashed request does not block the key
+func NewStore(redisLib redis.LibInterface, ttl, inFlightTTL time.Duration) *Store {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	if inFlightTTL <= 0 {
+		inFlightTTL = defaultInFlightTTL
+	}
+	return &Store{
+		redis:       redisLib,
+		memory:      cache.NewLRU(memoryMaxEntries),
+		ttl:         ttl,
+		inFlightTTL: inFlightTTL,
+	}
+}
+
+func (s *Store) lib() redis.LibInterface {
+	if s.redis != nil && redis.Available(s.redis) {
+		return s.redis
+	}
+	return s.memory
+}
+
+// Begin claims key for a request with fingerprint. When the key is already
+// claimed it returns the existing record and acquired is false.
+func (s *Store) Begin(key, fingerprint string) (existing Record, acquired bool, err error) {
+	claim, err := json.Marshal(Record{State: StateInFlight, Fingerprint: fingerprint})
+	if err != nil {
+		return Record{}, false, err
+	}
+	lib := s.lib()
+	err = lib.SetIdempotencyKey(keyPrefix+key, claim, s.inFlightTTL)
+	if err == nil {
+		return Record{}, true, nil
+	}
+	if !errors.Is(err, redis.ErrMultipleKeyInCache) {
+		return Record{}, false, err
+	}
+
+	raw := lib.Get(keyPrefix + key)
+	if raw == "" {
+		// the claim expired in between
+		return Record{}, false, ErrRecordNotFound
+	}
+	if err = json.Unmarshal([]byte(raw), &existing); err != nil {
+		return Record{}, false, err
+	}
+	return existing, false, nil
+}
+
+// Complete stores the response of the request that claimed key
+func (s *Store) Complete(key string, record Record) error {
+	record.State = StateCompleted
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.lib().Set(keyPrefix+key, data, s.ttl)
+}
+
+// Release drops a claim so the request can be retried, e.g. after a server
+// error
+func (s *Store) Release(key string) error {
+	return s.lib().DeleteKey(keyPrefix + key)
+}
@@ -0,0 +1,372 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/retry"
+
+	"github.com/lib/pq"
+)
+
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	// StatusFailed is a job whose handler gave up with a Permanent error
+	StatusFailed = "failed"
+	// StatusDead is a job that failed every attempt, it stays until an
+	// operator retries or inspects it
+	StatusDead      = "dead"
+	StatusCancelled = "cancelled"
+
+	defaultPollInterval      = time.Second
+	defaultVisibilityTimeout = 5 * time.Minute
+	defaultMaxAttempts       = 5
+	defaultConcurrency       = 1
+	defaultRetryInterval     = 10 * time.Second
+	defaultRetryMaxInterval  = 10 * time.Minute
+
+	// jobColumns are read for every job, the input is only read when a job
+	// is claimed
+	jobColumns = `id, kind, status, params, progress, error, attempts, max_attempts, run_at,
+	locked_by, locked_until, created_at, updated_at, started_at, finished_at`
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobState rejects a retry or a cancel the job status does not allow
+	ErrJobState = errors.New("job status does not allow this operation")
+)
+
+// Job is a unit of background work. Params and progress are json documents
+// whose shape depends on the kind, input is an optional blob such as an
+// uploaded file.
+type Job struct {
+	ID          int64
+	Kind        string
+	Status      string
+	Params      json.RawMessage
+	Input       []byte
+	Progress    json.RawMessage
+	Error       string
+	Attempts    int
+	MaxAttempts int
+	RunAt       time.Time
+	// LockedBy identifies the claim of a running job, it changes whenever
+	// the job is claimed again
+	LockedBy    string
+	LockedUntil *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   *time.Time
+	StartedAt   *time.Time
+	FinishedAt  *time.Time
+}
+
+// Settings tune a Queue, a zero field takes its default
+type Settings struct {
+	// PollInterval is how often an idle worker looks for a job
+	PollInterval time.Duration
+	// VisibilityTimeout hides a claimed job from the other workers, it is
+	// extended while the handler runs so only a stalled worker loses it
+	VisibilityTimeout time.Duration
+	// MaxAttempts is the default number of attempts of a job
+	MaxAttempts int
+	// Concurrency is the default number of workers per kind
+	Concurrency int
+	// Backoff paces the attempts of a failing job
+	Backoff retry.Policy
+}
+
+// EnqueueOptions are the optional parts of a new job
+type EnqueueOptions struct {
+	Input    []byte
+	Progress interface{}
+	// MaxAttempts overrides Settings.MaxAttempts when positive
+	MaxAttempts int
+	// Delay postpones the first attempt
+	Delay time.Duration
+}
+
+// Filter selects the jobs of a List, an empty field matches every job
+type Filter struct {
+	Kind   string
+	Status string
+	Limit  int
+	Offset int
+}
+
+// Enqueuer is the part of the Queue that services depend on to start work
+type Enqueuer interface {
+	Enqueue(ctx context.Context, kind string, params interface{}, opts EnqueueOptions) (Job, error)
+}
+
+// Queue is a job queue stored in the jobs table of postgres. Any number of
+// replicas may run workers on it, a job is claimed by a single one with
+// select ... for update skip locked.
+type Queue struct {
+	db       *sql.DB
+	settings Settings
+	worker   string
+
+	mu       sync.Mutex
+	handlers map[string]*registration
+	running  bool
+}
+
+func NewQueue(db *sql.DB, settings Settings) *Queue {
+	if settings.PollInterval <= 0 {
+		settings.PollInterval = defaultPollInterval
+	}
+	if settings.VisibilityTimeout <= 0 {
+		settings.VisibilityTimeout = defaultVisibilityTimeout
+	}
+	if settings.MaxAttempts <= 0 {
+		settings.MaxAttempts = defaultMaxAttempts
+	}
+	if settings.Concurrency <= 0 {
+		settings.Concurrency = defaultConcurrency
+	}
+	if settings.Backoff.InitialInterval <= 0 {
+		settings.Backoff.InitialInterval = defaultRetryInterval
+	}
+	if settings.Backoff.MaxInterval <= 0 {
+		settings.Backoff.MaxInterval = defaultRetryMaxInterval
+	}
+	hostname, _ := os.Hostname()
+	return &Queue{
+		db:       db,
+		settings: settings,
+		worker:   fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		handlers: make(map[string]*registration),
+	}
+}
+
+// Enqueue stores a queued job, params and opts.Progress are marshalled to
+// json. The workers of this replica are woken up at once.
+func (q *Queue) Enqueue(ctx context.Context, kind string, params interface{}, opts EnqueueOptions) (Job, error) {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return Job{}, fmt.Errorf("enqueue %s: params: %w", kind, err)
+	}
+	progressJSON := []byte("{}")
+	if opts.Progress != nil {
+		if progressJSON, err = json.Marshal(opts.Progress); err != nil {
+			return Job{}, fmt.Errorf("enqueue %s: progress: %w", kind, err)
+		}
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = q.settings.MaxAttempts
+	}
+
+	row := q.db.QueryRowContext(ctx, `insert into jobs (kind, status, params, input, progress, max_attempts, run_at)
+	values ($1, $2, $3, $4, $5, $6, now() + $7::float8 * interval '1 millisecond')
+	returning `+jobColumns, kind, StatusQueued, string(paramsJSON), opts.Input, string(progressJSON), maxAttempts, opts.Delay.Milliseconds())
+	job, err := scanJob(row)
+	if err != nil {
+		return Job{}, fmt.Errorf("enqueue %s: %w", kind, err)
+	}
+	job.Input = opts.Input
+	q.wake(kind)
+	return job, nil
+}
+
+// Get reads a job without its input
+func (q *Queue) Get(ctx context.Context, id int64) (Job, error) {
+	job, err := scanJob(q.db.QueryRowContext(ctx, `select `+jobColumns+` from jobs where id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrJobNotFound
+	}
+	return job, err
+}
+
+// List reads the jobs matching filter without their input, newest first,
+// along with how many match in total
+func (q *Queue) List(ctx context.Context, filter Filter) ([]Job, int64, error) {
+	where := make([]string, 0, 2)
+	args := make([]interface{}, 0, 4)
+	if filter.Kind != "" {
+		args = append(args, filter.Kind)
+		where = append(where, fmt.Sprintf("kind = $%d", len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where = append(where, fmt.Sprintf("status = $%d", len(args)))
+	}
+	condition := ""
+	if len(where) > 0 {
+		condition = " where " + strings.Join(where, " and ")
+	}
+
+	var count int64
+	if err := q.db.QueryRowContext(ctx, `select count(*) from jobs`+condition, args...).Scan(&count); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	rows, err := q.db.QueryContext(ctx, fmt.Sprintf(`select %s from jobs%s order by id desc limit $%d offset $%d`,
+		jobColumns, condition, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := make([]Job, 0, filter.Limit)
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, job)
+	}
+	return list, count, rows.Err()
+}
+
+// Retry queues a failed, dead or cancelled job again with a fresh set of
+// attempts, its progress is kept for the handler to resume from
+func (q *Queue) Retry(ctx context.Context, id int64) (Job, error) {
+	job, err := q.transition(ctx, id, `status = $2, attempts = 0, run_at = now(), error = '', locked_by = '',
+	locked_until = null, finished_at = null, updated_at = now()`,
+		[]string{StatusFailed, StatusDead, StatusCancelled}, StatusQueued)
+	if err != nil {
+		return Job{}, err
+	}
+	q.wake(job.Kind)
+	return job, nil
+}
+
+// Cancel stops a queued or running job, a running handler sees its ctx
+// cancelled at its next lease extension
+func (q *Queue) Cancel(ctx context.Context, id int64) (Job, error) {
+	return q.transition(ctx, id, `status = $2, locked_by = '', locked_until = null, finished_at = now(), updated_at = now()`,
+		[]string{StatusQueued, StatusRunning}, StatusCancelled)
+}
+
+// transition applies set to a job in one of the from statuses, $2 is the
+// new status
+func (q *Queue) transition(ctx context.Context, id int64, set string, from []string, status string) (Job, error) {
+	job, err := scanJob(q.db.QueryRowContext(ctx, `update jobs set `+set+`
+	where id = $1 and status = any($3)
+	returning `+jobColumns, id, status, pq.Array(from)))
+	if !errors.Is(err, sql.ErrNoRows) {
+		return job, err
+	}
+	if _, err = q.Get(ctx, id); err != nil {
+		return Job{}, err
+	}
+	return Job{}, fmt.Errorf("%w: only a job %s can be %s", ErrJobState, strings.Join(from, ", "), status)
+}
+
+// claim takes the next job of kind that is due or whose lease expired, it
+// returns sql.ErrNoRows when there is none
+func (q *Queue) claim(ctx context.Context, kind string) (Job, error) {
+	token := q.worker + "-" + newClaimToken()
+	row := q.db.QueryRowContext(ctx, `update jobs set status = $2, attempts = attempts + 1, locked_by = $3,
+	locked_until = now() + $4::float8 * interval '1 millisecond', started_at = coalesce(started_at, now()), updated_at = now()
+	where id = (
+		select id from jobs
+		where kind = $1 and ((status = $5 and run_at <= now()) or (status = $2 and locked_until < now()))
+		order by run_at, id
+		limit 1
+		for update skip locked
+	)
+	returning `+jobColumns+`, input`, kind, StatusRunning, token, q.settings.VisibilityTimeout.Milliseconds(), StatusQueued)
+	return scanJob(row, &inputColumn{})
+}
+
+// extend pushes the lease of a running job, false means the job was
+// cancelled or claimed by another worker
+func (q *Queue) extend(ctx context.Context, job *Job) (bool, error) {
+	result, err := q.db.ExecContext(ctx, `update jobs set locked_until = now() + $3::float8 * interval '1 millisecond'
+	where id = $1 and status = 'running' and locked_by = $2`, job.ID, job.LockedBy, q.settings.VisibilityTimeout.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// finish ends the claim of a job with set, $3 onwards are its arguments.
+// A job cancelled or claimed again in the meantime is left alone.
+func (q *Queue) finish(ctx context.Context, job *Job, set string, args ...interface{}) error {
+	_, err := q.db.ExecContext(ctx, `update jobs set `+set+`, locked_by = '', locked_until = null, updated_at = now()
+	where id = $1 and status = 'running' and locked_by = $2`, append([]interface{}{job.ID, job.LockedBy}, args...)...)
+	return err
+}
+
+func (q *Queue) complete(ctx context.Context, job *Job) error {
+	return q.finish(ctx, job, `status = $3, error = '', finished_at = now()`, StatusSucceeded)
+}
+
+// requeue schedules the next attempt of a failed job after delay
+func (q *Queue) requeue(ctx context.Context, job *Job, delay time.Duration, message string) error {
+	return q.finish(ctx, job, `status = $3, error = $4, run_at = now() + $5::float8 * interval '1 millisecond'`,
+		StatusQueued, message, delay.Milliseconds())
+}
+
+// release hands a job back without counting the attempt, e.g. on shutdown
+func (q *Queue) release(ctx context.Context, job *Job) error {
+	return q.finish(ctx, job, `status = $3, attempts = greatest(attempts - 1, 0), run_at = now()`, StatusQueued)
+}
+
+func (q *Queue) fail(ctx context.Context, job *Job, status string, message string) error {
+	return q.finish(ctx, job, `status = $3, error = $4, finished_at = now()`, status, message)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// inputColumn reads the input that follows jobColumns in a claim
+type inputColumn struct {
+	input []byte
+}
+
+func scanJob(row scanner, extra ...*inputColumn) (Job, error) {
+	var job Job
+	var params, progress []byte
+	var lockedUntil, updatedAt, startedAt, finishedAt sql.NullTime
+	dest := []interface{}{
+		&job.ID, &job.Kind, &job.Status, &params, &progress, &job.Error, &job.Attempts, &job.MaxAttempts, &job.RunAt,
+		&job.LockedBy, &lockedUntil, &job.CreatedAt, &updatedAt, &startedAt, &finishedAt,
+	}
+	for _, column := range extra {
+		dest = append(dest, &column.input)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return Job{}, err
+	}
+	job.Params = json.RawMessage(params)
+	job.Progress = json.RawMessage(progress)
+	job.LockedUntil = nullTime(lockedUntil)
+	job.UpdatedAt = nullTime(updatedAt)
+	job.StartedAt = nullTime(startedAt)
+	job.FinishedAt = nullTime(finishedAt)
+	for _, column := range extra {
+		job.Input = column.input
+	}
+	return job, nil
+}
+
+func nullTime(value sql.NullTime) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Time
+}
+
+func newClaimToken() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,262 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/retry"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// finishTimeout bounds the update recording the outcome of an attempt, it
+// runs on a fresh ctx since the worker ctx may be why the handler returned
+const finishTimeout = 5 * time.Second
+
+// HandlerFunc runs one attempt of a job, its ctx is cancelled when the job
+// is cancelled, its lease is lost or the queue shuts down
+type HandlerFunc func(ctx context.Context, job *Job) error
+
+// HandlerOptions tune the workers of a kind, a zero field takes the queue
+// settings
+type HandlerOptions struct {
+	// Concurrency is the number of jobs of the kind a replica runs at once
+	Concurrency int
+}
+
+type registration struct {
+	kind        string
+	handle      HandlerFunc
+	concurrency int
+	// wake interrupts the poll wait of an idle worker
+	wake chan struct{}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks a handler error that another attempt would hit again, the
+// job fails at once instead of being retried
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// Register sets the handler of kind, it must be called before Run
+func (q *Queue) Register(kind string, opts HandlerOptions, handle HandlerFunc) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.running {
+		panic(fmt.Sprintf("jobs: register %s after the queue started", kind))
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = q.settings.Concurrency
+	}
+	q.handlers[kind] = &registration{
+		kind:        kind,
+		handle:      handle,
+		concurrency: concurrency,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Handle registers a handler receiving the params of its jobs decoded as T,
+// params that do not decode fail the job without retrying it
+func Handle[T any](q *Queue, kind string, opts HandlerOptions, fn func(ctx context.Context, job *Job, params T) error) {
+	q.Register(kind, opts, func(ctx context.Context, job *Job) error {
+		var params T
+		if err := json.Unmarshal(job.Params, &params); err != nil {
+			return Permanent(fmt.Errorf("decode params: %w", err))
+		}
+		return fn(ctx, job, params)
+	})
+}
+
+// wake nudges an idle worker of kind on this replica
+func (q *Queue) wake(kind string) {
+	q.mu.Lock()
+	r := q.handlers[kind]
+	q.mu.Unlock()
+	if r == nil {
+		return
+	}
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run starts the workers of every registered kind and blocks until ctx is
+// done and they all returned. A job running at shutdown is handed back to
+// the queue without counting its attempt.
+func (q *Queue) Run(ctx context.Context) {
+	q.mu.Lock()
+	q.running = true
+	handlers := make([]*registration, 0, len(q.handlers))
+	for _, r := range q.handlers {
+		handlers = append(handlers, r)
+	}
+	q.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, r := range handlers {
+		for i := 0; i < r.concurrency; i++ {
+			wg.Add(1)
+			go func(r *registration) {
+				defer wg.Done()
+				q.work(ctx, r)
+			}(r)
+		}
+	}
+	wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context, r *registration) {
+	for ctx.Err() == nil {
+		job, err := q.claim(ctx, r.kind)
+		if err == nil {
+			q.process(ctx, r, &job)
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) && ctx.Err() == nil {
+			log.Errorf("jobs: claim %s: %v", r.kind, err)
+		}
+
+		timer := time.NewTimer(q.settings.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-r.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// process runs one attempt of a claimed job and records its outcome
+func (q *Queue) process(ctx context.Context, r *registration, job *Job) {
+	if job.Attempts > job.MaxAttempts {
+		// the lease of the last attempt expired, its worker died or stalled
+		q.record(job, "dead-letter", func(ctx context.Context) error {
+			return q.fail(ctx, job, StatusDead, "the last attempt did not finish before its lease expired")
+		})
+		return
+	}
+
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lost := make(chan struct{})
+	extended := make(chan struct{})
+	go func() {
+		defer close(extended)
+		q.keepLease(workCtx, job, lost, cancel)
+	}()
+
+	err := q.call(workCtx, r, job)
+	cancel()
+	<-extended
+
+	select {
+	case <-lost:
+		log.Warnf("jobs: %s %d was cancelled or lost its lease, its outcome is dropped", job.Kind, job.ID)
+		return
+	default:
+	}
+
+	var errPermanent permanentError
+	switch {
+	case err == nil:
+		q.record(job, "complete", func(ctx context.Context) error {
+			return q.complete(ctx, job)
+		})
+	case ctx.Err() != nil:
+		q.record(job, "release", func(ctx context.Context) error {
+			return q.release(ctx, job)
+		})
+	case errors.As(err, &errPermanent):
+		log.Errorf("jobs: %s %d failed: %v", job.Kind, job.ID, err)
+		q.record(job, "fail", func(ctx context.Context) error {
+			return q.fail(ctx, job, StatusFailed, err.Error())
+		})
+	case job.Attempts >= job.MaxAttempts:
+		log.Errorf("jobs: %s %d failed attempt %d/%d: %v, dead-lettering it", job.Kind, job.ID, job.Attempts, job.MaxAttempts, err)
+		q.record(job, "dead-letter", func(ctx context.Context) error {
+			return q.fail(ctx, job, StatusDead, err.Error())
+		})
+	default:
+		delay := retry.Backoff(q.settings.Backoff, job.Attempts)
+		log.Warnf("jobs: %s %d failed attempt %d/%d: %v, retrying in %s", job.Kind, job.ID, job.Attempts, job.MaxAttempts, err, delay.Round(time.Millisecond))
+		q.record(job, "requeue", func(ctx context.Context) error {
+			return q.requeue(ctx, job, delay, err.Error())
+		})
+	}
+}
+
+// call runs the handler, a panic fails the attempt like an error
+func (q *Queue) call(ctx context.Context, r *registration, job *Job) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("handler panicked: %v", recovered)
+		}
+	}()
+	return r.handle(ctx, job)
+}
+
+// keepLease extends the lease of a running job every third of the
+// visibility timeout. A failed extension is retried until the lease may have
+// run out, then the job counts as lost and the handler ctx is cancelled.
+func (q *Queue) keepLease(ctx context.Context, job *Job, lost chan<- struct{}, cancel context.CancelFunc) {
+	interval := q.settings.VisibilityTimeout / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	leaseUntil := time.Now().Add(q.settings.VisibilityTimeout)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			held, err := q.extend(ctx, job)
+			if err == nil && held {
+				leaseUntil = time.Now().Add(q.settings.VisibilityTimeout)
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil && time.Now().Add(interval).Before(leaseUntil) {
+				log.Warnf("jobs: extend %s %d: %v, retrying", job.Kind, job.ID, err)
+				continue
+			}
+			close(lost)
+			cancel()
+			return
+		}
+	}
+}
+
+// record runs the update ending an attempt on a fresh ctx
+func (q *Queue) record(job *Job, action string, fn func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), finishTimeout)
+	defer cancel()
+	if err := fn(ctx); err != nil {
+		log.Errorf("jobs: %s %s %d: %v", action, job.Kind, job.ID, err)
+	}
+}
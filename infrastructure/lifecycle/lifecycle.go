@@ -0,0 +1,162 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultDrainTimeout = 15 * time.Second
+)
+
+var (
+	ErrShuttingDown = errors.New("lifecycle manager is shutting down")
+	ErrDrainTimeout = errors.New("timed out waiting for background workers to drain")
+)
+
+// Spawner is the part of the Manager that services depend on to start
+// background work, it keeps them decoupled from the shutdown sequence.
+type Spawner interface {
+	Go(name string, fn func(ctx context.Context)) bool
+}
+
+type closer struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Manager owns every background goroutine and every client that has to be
+// closed when the process stops.
+type Manager struct {
+	ctx          context.Context
+	cancel       context.CancelFunc
+	drainTimeout time.Duration
+
+	// loops are cancelled as soon as Shutdown starts, the workers only once
+	// draining them timed out
+	loopCtx    context.Context
+	cancelLoop context.CancelFunc
+
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	stopping bool
+	closers  []closer
+}
+
+func New(drainTimeout time.Duration) *Manager {
+	if drainTimeout <= 0 {
+		drainTimeout = defaultDrainTimeout
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	loopCtx, cancelLoop := context.WithCancel(ctx)
+	return &Manager{
+		ctx:          ctx,
+		cancel:       cancel,
+		drainTimeout: drainTimeout,
+		loopCtx:      loopCtx,
+		cancelLoop:   cancelLoop,
+	}
+}
+
+// Context is cancelled once Shutdown gave up waiting for the workers to
+// drain, work still running then should return.
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+func (m *Manager) DrainTimeout() time.Duration {
+	return m.drainTimeout
+}
+
+// Go runs fn on a tracked goroutine. It returns false without running fn
+// when the manager is already shutting down.
+func (m *Manager) Go(name string, fn func(ctx context.Context)) bool {
+	return m.spawn(m.ctx, name, fn)
+}
+
+// Loop runs fn like Go for a long-running worker, e.g. a poller, that only
+// returns once its ctx is done. Its ctx is cancelled as soon as Shutdown
+// starts.
+func (m *Manager) Loop(name string, fn func(ctx context.Context)) bool {
+	return m.spawn(m.loopCtx, name, fn)
+}
+
+func (m *Manager) spawn(ctx context.Context, name string, fn func(ctx context.Context)) bool {
+	m.mu.Lock()
+	if m.stopping {
+		m.mu.Unlock()
+		log.Warnf("lifecycle: refusing to start %s, %v", name, ErrShuttingDown)
+		return false
+	}
+	m.wg.Add(1)
+	m.mu.Unlock()
+
+	go func() {
+		defer m.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Errorf("lifecycle: background worker %s panicked: %v", name, r)
+			}
+		}()
+		fn(ctx)
+	}()
+	return true
+}
+
+// OnShutdown registers a closer that runs after the background workers have
+// drained. Closers run in reverse registration order, like defer.
+func (m *Manager) OnShutdown(name string, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closers = append(m.closers, closer{name: name, fn: fn})
+}
+
+// Shutdown stops the loops and waits for every tracked goroutine to return
+// until ctx is done, only then the worker context is cancelled. It then runs
+// the registered closers. The returned error is non-nil when draining timed
+// out or any closer failed.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if m.stopping {
+		m.mu.Unlock()
+		return ErrShuttingDown
+	}
+	m.stopping = true
+	closers := m.closers
+	m.mu.Unlock()
+
+	m.cancelLoop()
+	defer m.cancel()
+
+	var errs []error
+
+	drained := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		log.Info("lifecycle: background workers drained")
+	case <-ctx.Done():
+		m.cancel()
+		errs = append(errs, ErrDrainTimeout)
+	}
+
+	for i := len(closers) - 1; i >= 0; i-- {
+		c := closers[i]
+		if err := c.fn(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("close %s: %w", c.name, err))
+			continue
+		}
+		log.Infof("lifecycle: closed %s", c.name)
+	}
+
+	return errors.Join(errs...)
+}
@@ -1,15 +1,34 @@
 package limiter
 
-import "time"
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+type bucket struct {
+	rate     int           // Number of actions allowed per time window
+	interval time.Duration // Time window duration
+	tokens   chan struct{} // Channel to hold tokens
+}
 
 type RateLimiter struct {
-	rate       int           // Number of actions allowed per time window
-	interval   time.Duration // Time window duration
-	tokenCount int           // Available tokens at the moment
-	tokens     chan struct{} // Channel to hold tokens
+	current atomic.Pointer[bucket] // swapped as a whole by Update
+	changed chan struct{}          // wakes Run up after an Update
 }
 
+// NewRateLimiter builds the limiter, tokens are only refilled while Run is
+// running so the caller decides who owns that goroutine.
 func NewRateLimiter(rate int, interval time.Duration) *RateLimiter {
+	limiter := &RateLimiter{
+		changed: make(chan struct{}, 1),
+	}
+	limiter.current.Store(newBucket(rate, interval))
+
+	return limiter
+}
+
+func newBucket(rate int, interval time.Duration) *bucket {
 	if rate == 0 {
 		rate = 1
 	}
@@ -18,25 +37,59 @@ func NewRateLimiter(rate int, interval time.Duration) *RateLimiter {
 		interval = time.Second
 	}
 
-	limiter := &RateLimiter{
-		rate:       rate,
-		interval:   interval,
-		tokenCount: rate,
-		tokens:     make(chan struct{}, rate),
+	return &bucket{
+		rate:     rate,
+		interval: interval,
+		tokens:   make(chan struct{}, rate),
 	}
+}
 
-	go limiter.refillTokens()
+// Update swaps the rate and interval atomically. The new bucket starts with
+// the tokens left in the old one, capped at the new rate, so a reload neither
+// blocks the traffic until the next tick nor grants a fresh burst.
+func (limiter *RateLimiter) Update(rate int, interval time.Duration) {
+	b := newBucket(rate, interval)
+	remaining := len(limiter.current.Load().tokens)
+	for i := 0; i < remaining && i < b.rate; i++ {
+		b.tokens <- struct{}{}
+	}
+	limiter.current.Store(b)
+	select {
+	case limiter.changed <- struct{}{}:
+	default:
+	}
+}
 
-	return limiter
+// Run refills the tokens until ctx is done.
+func (limiter *RateLimiter) Run(ctx context.Context) {
+	for {
+		b := limiter.current.Load()
+		tick := b.interval / time.Duration(b.rate)
+		if tick <= 0 {
+			tick = time.Nanosecond
+		}
+		if !limiter.refill(ctx, b, tick) {
+			return
+		}
+	}
 }
 
-func (limiter *RateLimiter) refillTokens() {
+// refill fills b on every tick, it returns false once ctx is done and true
+// when the bucket has been replaced.
+func (limiter *RateLimiter) refill(ctx context.Context, b *bucket, tick time.Duration) bool {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
 	for {
 		select {
-		case <-time.After(limiter.interval / time.Duration(limiter.rate)):
-			for i := 0; i < limiter.rate; i++ {
+		case <-ctx.Done():
+			return false
+		case <-limiter.changed:
+			return true
+		case <-ticker.C:
+			for i := 0; i < b.rate; i++ {
 				select {
-				case limiter.tokens <- struct{}{}:
+				case b.tokens <- struct{}{}:
 				default:
 					//just next the request, don't block it
 				}
@@ -47,7 +100,7 @@ func (limiter *RateLimiter) refillTokens() {
 
 func (limiter *RateLimiter) Allow() bool {
 	select {
-	case <-limiter.tokens:
+	case <-limiter.current.Load().tokens:
 		return true
 	default:
 		return false
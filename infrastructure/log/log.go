@@ -19,6 +19,13 @@ func Init(logFormat, logLevel string) {
 			FullTimestamp: true,
 		})
 	}
+	SetLevel(logLevel)
+	log.SetOutput(os.Stdout)
+}
+
+// SetLevel changes the level of the global logger, it is safe to call while
+// other goroutines are logging
+func SetLevel(logLevel string) {
 	switch strings.ToLower(logLevel) {
 	case "info":
 		log.SetLevel(log.InfoLevel)
@@ -31,7 +38,6 @@ func Init(logFormat, logLevel string) {
 	default:
 		log.SetLevel(log.InfoLevel)
 	}
-	log.SetOutput(os.Stdout)
 }
 
 func getEntry(ctx context.Context, ctxName string) *log.Entry {
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+var (
+	mu        sync.RWMutex
+	published = make(map[string]func() interface{})
+)
+
+// Publish exposes the value returned by fn under name on the metrics
+// endpoint, fn is called on every scrape. Publishing a name twice keeps
+// the first one.
+func Publish(name string, fn func() interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := published[name]; ok {
+		return
+	}
+	published[name] = fn
+}
+
+// Handler serves every published metric as JSON. Unlike the expvar handler
+// it leaves out the runtime memstats and the command line of the process.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.RLock()
+		values := make(map[string]interface{}, len(published))
+		for name, fn := range published {
+			values[name] = fn()
+		}
+		mu.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(values)
+	})
+}
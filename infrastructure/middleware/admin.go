@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"go-bunrouter-gorm-example/infrastructure/httplib"
+
+	"github.com/uptrace/bunrouter"
+)
+
+// AdminTokenMiddleware lets through the requests sending token as a bearer
+// token in the Authorization header. An empty token disables the endpoints
+// behind it, every request is then forbidden.
+func AdminTokenMiddleware(token string) bunrouter.MiddlewareFunc {
+	return func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+		return func(w http.ResponseWriter, req bunrouter.Request) error {
+			if token == "" {
+				return httplib.SetErrorResponse(w, http.StatusForbidden, "admin endpoints are disabled")
+			}
+
+			sent, ok := bearerToken(req.Request)
+			if !ok || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				return httplib.SetErrorResponse(w, http.StatusUnauthorized, "invalid admin token")
+			}
+			return next(w, req)
+		}
+	}
+}
+
+func bearerToken(req *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
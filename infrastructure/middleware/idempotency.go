@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"go-bunrouter-gorm-example/infrastructure/httplib"
+	"go-bunrouter-gorm-example/infrastructure/idempotency"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/uptrace/bunrouter"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	defaultIdempotentBodySize = 1 << 20
+)
+
+// IdempotencyMiddleware makes an unsafe request carrying an Idempotency-Key
+// header run once: a retry with the same key and payload gets the stored
+// response, a retry while the first request still runs gets 409 and a key
+// reused with another payload gets 422. Server errors are not stored so the
+// request can be retried. A body is read up to maxBodyBytes, an upload, a
+// multipart/form-data body, up to maxUploadBytes.
+func IdempotencyMiddleware(store *idempotency.Store, maxBodyBytes, maxUploadBytes int64) bunrouter.MiddlewareFunc {
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = defaultIdempotentBodySize
+	}
+	if maxUploadBytes < maxBodyBytes {
+		maxUploadBytes = maxBodyBytes
+	}
+	return func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+		return func(w http.ResponseWriter, req bunrouter.Request) error {
+			key := req.Header.Get(IdempotencyKeyHeader)
+			if store == nil || key == "" || !isUnsafeMethod(req.Method) {
+				return next(w, req)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return httplib.SetErrorResponse(w, http.StatusBadRequest, "Idempotency-Key is too long")
+			}
+
+			// the body is read to fingerprint it and handed on untouched
+			limit := maxBodyBytes
+			if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+				limit = maxUploadBytes
+			}
+			body, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+			if err != nil {
+				return httplib.SetErrorResponse(w, http.StatusBadRequest, "failed to read the request body")
+			}
+			if int64(len(body)) > limit {
+				return httplib.SetErrorResponse(w, http.StatusRequestEntityTooLarge, "request body is too large for an idempotent request")
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			// a key is scoped to its route and query, the same key on
+			// another endpoint is another operation
+			target := req.URL.Path
+			if req.URL.RawQuery != "" {
+				target += "?" + req.URL.RawQuery
+			}
+			scopedKey := req.Method + " " + target + ":" + key
+			fingerprint := requestFingerprint(req.Method, target, body)
+
+			existing, acquired, err := store.Begin(scopedKey, fingerprint)
+			switch {
+			case errors.Is(err, idempotency.ErrRecordNotFound):
+				return httplib.SetErrorResponse(w, http.StatusConflict, "a request with this Idempotency-Key is being processed, retry later")
+			case err != nil:
+				log.Errorf("idempotency: begin %s: %v", scopedKey, err)
+				return httplib.SetErrorResponse(w, http.StatusServiceUnavailable, "idempotency store is unavailable, retry later")
+			case !acquired && existing.Fingerprint != fingerprint:
+				return httplib.SetErrorResponse(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request")
+			case !acquired && existing.State != idempotency.StateCompleted:
+				return httplib.SetErrorResponse(w, http.StatusConflict, "a request with this Idempotency-Key is being processed, retry later")
+			case !acquired:
+				return replay(w, existing)
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w}
+			err = next(recorder, req)
+			status := recorder.statusCode()
+			if err != nil || status >= http.StatusInternalServerError {
+				if errRelease := store.Release(scopedKey); errRelease != nil {
+					log.Errorf("idempotency: release %s: %v", scopedKey, errRelease)
+				}
+				return err
+			}
+			// a replay must not hand out the cookies of the first response,
+			// e.g. the read-your-writes pin of another client
+			header := recorder.header.Clone()
+			header.Del("Set-Cookie")
+			errComplete := store.Complete(scopedKey, idempotency.Record{
+				Fingerprint: fingerprint,
+				Status:      status,
+				Header:      header,
+				Body:        recorder.body.Bytes(),
+			})
+			if errComplete != nil {
+				log.Errorf("idempotency: complete %s: %v", scopedKey, errComplete)
+			}
+			return nil
+		}
+	}
+}
+
+func requestFingerprint(method, target string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + "\n" + target + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, record idempotency.Record) error {
+	for name, values := range record.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(record.Status)
+	_, err := w.Write(record.Body)
+	return err
+}
+
+// responseRecorder writes through to the client and keeps a copy of the
+// response to store it
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+		r.header = r.ResponseWriter.Header().Clone()
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/database"
+
+	"github.com/uptrace/bunrouter"
+)
+
+const (
+	// pinPrimaryCookie holds the unix milliseconds until which a client
+	// reads from the primary after a write
+	pinPrimaryCookie = "pin_primary_until"
+)
+
+// ReadYourWritesMiddleware pins a client to the primary for window after it
+// made a write, the deadline travels in a cookie so it holds across every
+// replica of the app. A zero window disables the middleware.
+func ReadYourWritesMiddleware(window time.Duration) bunrouter.MiddlewareFunc {
+	return func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+		if window <= 0 {
+			return next
+		}
+		return func(w http.ResponseWriter, req bunrouter.Request) error {
+			pin := false
+			if until, ok := pinPrimaryUntil(req.Request); ok && time.Now().Before(until) {
+				pin = true
+			}
+
+			if isUnsafeMethod(req.Method) {
+				setPinPrimary(w, window)
+				pin = true
+			}
+
+			if pin {
+				req = req.WithContext(database.WithPrimary(req.Context()))
+			}
+			return next(w, req)
+		}
+	}
+}
+
+// pinPrimaryUntil reads the pin cookie of req
+func pinPrimaryUntil(req *http.Request) (time.Time, bool) {
+	cookie, err := req.Cookie(pinPrimaryCookie)
+	if err != nil {
+		return time.Time{}, false
+	}
+	millis, err := strconv.ParseInt(cookie.Value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(millis), true
+}
+
+// setPinPrimary pins the client to the primary for window from now
+func setPinPrimary(w http.ResponseWriter, window time.Duration) {
+	until := time.Now().Add(window)
+	http.SetCookie(w, &http.Cookie{
+		Name:     pinPrimaryCookie,
+		Value:    strconv.FormatInt(until.UnixMilli(), 10),
+		Path:     "/",
+		MaxAge:   int(math.Ceil(window.Seconds())),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func isUnsafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,283 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/breaker"
+
+	"github.com/go-redis/redis"
+)
+
+// breakerLib guards a LibInterface with a circuit breaker, while the breaker
+// is open Get reports a miss and writes fail fast with breaker.ErrOpen
+type breakerLib struct {
+	lib     ContextLibInterface
+	breaker *breaker.Breaker
+}
+
+// NewBreakerLib wraps lib with b, a cache miss and a lost SetIdempotencyKey
+// race do not count as failures
+func NewBreakerLib(lib ContextLibInterface, b *breaker.Breaker) ContextLibInterface {
+	return breakerLib{
+		lib:     lib,
+		breaker: b,
+	}
+}
+
+// IsFailure tells the errors that mean redis itself is unhealthy, a miss, a
+// lost race or a caller giving up is not one of them
+func IsFailure(err error) bool {
+	return err != nil &&
+		!errors.Is(err, redis.Nil) &&
+		!errors.Is(err, ErrMultipleKeyInCache) &&
+		!errors.Is(err, context.Canceled)
+}
+
+// Available reports whether calls to lib are currently let through, it is
+// always true for a lib without a breaker
+func Available(lib LibInterface) bool {
+	guarded, ok := lib.(breakerLib)
+	if !ok {
+		return true
+	}
+	return guarded.breaker.State() != breaker.StateOpen
+}
+
+func (r breakerLib) SetIdempotencyKey(key string, value interface{}, ttl time.Duration) error {
+	return r.breaker.Execute(func() error {
+		return r.lib.SetIdempotencyKey(key, value, ttl)
+	})
+}
+
+func (r breakerLib) DeleteKey(key string) error {
+	return r.breaker.Execute(func() error {
+		return r.lib.DeleteKey(key)
+	})
+}
+
+func (r breakerLib) Get(key string) (value string) {
+	// the plain Get swallows errors, use the error returning one so an
+	// outage trips the breaker
+	value, err := r.GetContext(context.Background(), key)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+func (r breakerLib) Set(key string, value interface{}, ttl time.Duration) error {
+	return r.breaker.Execute(func() error {
+		return r.lib.Set(key, value, ttl)
+	})
+}
+
+func (r breakerLib) Incr(key string) (value int64, err error) {
+	err = r.breaker.Execute(func() error {
+		value, err = r.lib.Incr(key)
+		return err
+	})
+	return value, err
+}
+
+func (r breakerLib) SetNX(key string, value interface{}, ttl time.Duration) (ok bool, err error) {
+	err = r.breaker.Execute(func() error {
+		ok, err = r.lib.SetNX(key, value, ttl)
+		return err
+	})
+	return ok, err
+}
+
+func (r breakerLib) GetContext(ctx context.Context, key string) (value string, err error) {
+	err = r.breaker.Execute(func() error {
+		value, err = r.lib.GetContext(ctx, key)
+		return err
+	})
+	return value, err
+}
+
+func (r breakerLib) SetContext(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return r.breaker.Execute(func() error {
+		return r.lib.SetContext(ctx, key, value, ttl)
+	})
+}
+
+func (r breakerLib) SetNXContext(ctx context.Context, key string, value interface{}, ttl time.Duration) (ok bool, err error) {
+	err = r.breaker.Execute(func() error {
+		ok, err = r.lib.SetNXContext(ctx, key, value, ttl)
+		return err
+	})
+	return ok, err
+}
+
+func (r breakerLib) DeleteContext(ctx context.Context, keys ...string) (deleted int64, err error) {
+	err = r.breaker.Execute(func() error {
+		deleted, err = r.lib.DeleteContext(ctx, keys...)
+		return err
+	})
+	return deleted, err
+}
+
+func (r breakerLib) IncrContext(ctx context.Context, key string) (value int64, err error) {
+	err = r.breaker.Execute(func() error {
+		value, err = r.lib.IncrContext(ctx, key)
+		return err
+	})
+	return value, err
+}
+
+func (r breakerLib) MGetContext(ctx context.Context, keys ...string) (values map[string]string, err error) {
+	err = r.breaker.Execute(func() error {
+		values, err = r.lib.MGetContext(ctx, keys...)
+		return err
+	})
+	return values, err
+}
+
+func (r breakerLib) MSetContext(ctx context.Context, values map[string]interface{}, ttl time.Duration) error {
+	return r.breaker.Execute(func() error {
+		return r.lib.MSetContext(ctx, values, ttl)
+	})
+}
+
+func (r breakerLib) HGetContext(ctx context.Context, key, field string) (value string, err error) {
+	err = r.breaker.Execute(func() error {
+		value, err = r.lib.HGetContext(ctx, key, field)
+		return err
+	})
+	return value, err
+}
+
+func (r breakerLib) HGetAllContext(ctx context.Context, key string) (values map[string]string, err error) {
+	err = r.breaker.Execute(func() error {
+		values, err = r.lib.HGetAllContext(ctx, key)
+		return err
+	})
+	return values, err
+}
+
+func (r breakerLib) HSetContext(ctx context.Context, key string, fields map[string]interface{}) error {
+	return r.breaker.Execute(func() error {
+		return r.lib.HSetContext(ctx, key, fields)
+	})
+}
+
+func (r breakerLib) HDelContext(ctx context.Context, key string, fields ...string) (deleted int64, err error) {
+	err = r.breaker.Execute(func() error {
+		deleted, err = r.lib.HDelContext(ctx, key, fields...)
+		return err
+	})
+	return deleted, err
+}
+
+func (r breakerLib) HIncrByContext(ctx context.Context, key, field string, increment int64) (value int64, err error) {
+	err = r.breaker.Execute(func() error {
+		value, err = r.lib.HIncrByContext(ctx, key, field, increment)
+		return err
+	})
+	return value, err
+}
+
+func (r breakerLib) ZAddContext(ctx context.Context, key string, members ...Z) (added int64, err error) {
+	err = r.breaker.Execute(func() error {
+		added, err = r.lib.ZAddContext(ctx, key, members...)
+		return err
+	})
+	return added, err
+}
+
+func (r breakerLib) ZRemContext(ctx context.Context, key string, members ...interface{}) (removed int64, err error) {
+	err = r.breaker.Execute(func() error {
+		removed, err = r.lib.ZRemContext(ctx, key, members...)
+		return err
+	})
+	return removed, err
+}
+
+func (r breakerLib) ZScoreContext(ctx context.Context, key, member string) (score float64, err error) {
+	err = r.breaker.Execute(func() error {
+		score, err = r.lib.ZScoreContext(ctx, key, member)
+		return err
+	})
+	return score, err
+}
+
+func (r breakerLib) ZRangeByScoreContext(ctx context.Context, key, min, max string, offset, count int64) (members []string, err error) {
+	err = r.breaker.Execute(func() error {
+		members, err = r.lib.ZRangeByScoreContext(ctx, key, min, max, offset, count)
+		return err
+	})
+	return members, err
+}
+
+func (r breakerLib) ZRevRangeContext(ctx context.Context, key string, start, stop int64) (members []string, err error) {
+	err = r.breaker.Execute(func() error {
+		members, err = r.lib.ZRevRangeContext(ctx, key, start, stop)
+		return err
+	})
+	return members, err
+}
+
+func (r breakerLib) TTLContext(ctx context.Context, key string) (ttl time.Duration, err error) {
+	err = r.breaker.Execute(func() error {
+		ttl, err = r.lib.TTLContext(ctx, key)
+		return err
+	})
+	return ttl, err
+}
+
+func (r breakerLib) ExpireContext(ctx context.Context, key string, ttl time.Duration) (ok bool, err error) {
+	err = r.breaker.Execute(func() error {
+		ok, err = r.lib.ExpireContext(ctx, key, ttl)
+		return err
+	})
+	return ok, err
+}
+
+func (r breakerLib) DeletePatternContext(ctx context.Context, pattern string) (deleted int64, err error) {
+	err = r.breaker.Execute(func() error {
+		deleted, err = r.lib.DeletePatternContext(ctx, pattern)
+		return err
+	})
+	return deleted, err
+}
+
+func (r breakerLib) CompareAndDeleteContext(ctx context.Context, key, value string) (ok bool, err error) {
+	err = r.breaker.Execute(func() error {
+		ok, err = r.lib.CompareAndDeleteContext(ctx, key, value)
+		return err
+	})
+	return ok, err
+}
+
+func (r breakerLib) CompareAndExpireContext(ctx context.Context, key, value string, ttl time.Duration) (ok bool, err error) {
+	err = r.breaker.Execute(func() error {
+		ok, err = r.lib.CompareAndExpireContext(ctx, key, value, ttl)
+		return err
+	})
+	return ok, err
+}
+
+func (r breakerLib) PublishContext(ctx context.Context, channel string, message string) error {
+	return r.breaker.Execute(func() error {
+		return r.lib.PublishContext(ctx, channel, message)
+	})
+}
+
+// SubscribeContext is refused with breaker.ErrOpen while the breaker is open
+// and a subscription ending with an error counts as a failure. It is not
+// executed by the breaker as a whole, a subscription is long lived and would
+// hold a half-open call and count as slow.
+func (r breakerLib) SubscribeContext(ctx context.Context, handler func(Message), channels ...string) error {
+	if !Available(r) {
+		return breaker.ErrOpen
+	}
+	err := r.lib.SubscribeContext(ctx, handler, channels...)
+	if err != nil {
+		_ = r.breaker.Execute(func() error {
+			return err
+		})
+	}
+	return err
+}
@@ -0,0 +1,420 @@
+package redis
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	// NoExpiry is the TTL of a key that never expires
+	NoExpiry time.Duration = -1
+
+	defaultScanCount int64 = 100
+)
+
+// ErrNil is returned by the context-aware reads for a missing key or field
+var ErrNil = redis.Nil
+
+// Z is a sorted set member
+type Z = redis.Z
+
+// Message is a pub/sub message
+type Message struct {
+	Channel string
+	Payload string
+}
+
+// ContextLibInterface extends LibInterface with context-aware calls that
+// report every redis error, a missing key is ErrNil and never a zero value
+type ContextLibInterface interface {
+	LibInterface
+
+	GetContext(ctx context.Context, key string) (string, error)
+	SetContext(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	SetNXContext(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error)
+	DeleteContext(ctx context.Context, keys ...string) (int64, error)
+	IncrContext(ctx context.Context, key string) (int64, error)
+	// MGetContext returns the keys that exist
+	MGetContext(ctx context.Context, keys ...string) (map[string]string, error)
+	// MSetContext sets every key with the same ttl in one pipeline
+	MSetContext(ctx context.Context, values map[string]interface{}, ttl time.Duration) error
+
+	HGetContext(ctx context.Context, key, field string) (string, error)
+	HGetAllContext(ctx context.Context, key string) (map[string]string, error)
+	HSetContext(ctx context.Context, key string, fields map[string]interface{}) error
+	HDelContext(ctx context.Context, key string, fields ...string) (int64, error)
+	HIncrByContext(ctx context.Context, key, field string, increment int64) (int64, error)
+
+	ZAddContext(ctx context.Context, key string, members ...Z) (int64, error)
+	ZRemContext(ctx context.Context, key string, members ...interface{}) (int64, error)
+	ZScoreContext(ctx context.Context, key, member string) (float64, error)
+	// ZRangeByScoreContext returns the members between min and max, both
+	// inclusive, use "-inf" and "+inf" for open bounds
+	ZRangeByScoreContext(ctx context.Context, key, min, max string, offset, count int64) ([]string, error)
+	// ZRevRangeContext returns the members from rank start to stop by
+	// descending score
+	ZRevRangeContext(ctx context.Context, key string, start, stop int64) ([]string, error)
+
+	// TTLContext returns NoExpiry for a key without ttl and ErrNil for a
+	// missing key
+	TTLContext(ctx context.Context, key string) (time.Duration, error)
+	ExpireContext(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// DeletePatternContext deletes the keys matching pattern with SCAN, it
+	// never blocks redis like KEYS would
+	DeletePatternContext(ctx context.Context, pattern string) (int64, error)
+
+	// CompareAndDeleteContext deletes key only while it holds value
+	CompareAndDeleteContext(ctx context.Context, key, value string) (bool, error)
+	// CompareAndExpireContext resets the ttl of key only while it holds
+	// value
+	CompareAndExpireContext(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+
+	PublishContext(ctx context.Context, channel string, message string) error
+	// SubscribeContext calls handler with every message of channels until
+	// ctx is done
+	SubscribeContext(ctx context.Context, handler func(Message), channels ...string) error
+}
+
+type result[T any] struct {
+	value T
+	err   error
+}
+
+// do runs fn unless ctx is already done. go-redis v6 can not cancel a
+// command, so when ctx ends first the call returns ctx.Err() and fn ends on
+// its own within the client timeouts.
+func do[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	if ctx.Done() == nil {
+		return fn()
+	}
+	done := make(chan result[T], 1)
+	go func() {
+		value, err := fn()
+		done <- result[T]{value: value, err: err}
+	}()
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+func doErr(ctx context.Context, fn func() error) error {
+	_, err := do(ctx, func() (struct{}, error) {
+		return struct{}{}, fn()
+	})
+	return err
+}
+
+func (r client) GetContext(ctx context.Context, key string) (string, error) {
+	return do(ctx, func() (string, error) {
+		return r.redisClient.Get(key).Result()
+	})
+}
+
+func (r client) SetContext(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return doErr(ctx, func() error {
+		return r.redisClient.Set(key, value, ttl).Err()
+	})
+}
+
+func (r client) SetNXContext(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	return do(ctx, func() (bool, error) {
+		return r.redisClient.SetNX(key, value, ttl).Result()
+	})
+}
+
+func (r client) DeleteContext(ctx context.Context, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	if !r.cluster() {
+		return do(ctx, func() (int64, error) {
+			return r.redisClient.Del(keys...).Result()
+		})
+	}
+	// the keys may live in different slots, DEL them one by one in a
+	// pipeline that the cluster client routes per key
+	return do(ctx, func() (int64, error) {
+		cmds, err := r.redisClient.Pipelined(func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				pipe.Del(key)
+			}
+			return nil
+		})
+		var deleted int64
+		for _, cmd := range cmds {
+			deleted += cmd.(*redis.IntCmd).Val()
+		}
+		return deleted, err
+	})
+}
+
+// cluster reports whether keys are spread over several nodes, multi-key
+// commands then fail unless every key hashes to the same slot
+func (r client) cluster() bool {
+	_, ok := r.redisClient.(*redis.ClusterClient)
+	return ok
+}
+
+func (r client) IncrContext(ctx context.Context, key string) (int64, error) {
+	return do(ctx, func() (int64, error) {
+		return r.redisClient.Incr(key).Result()
+	})
+}
+
+func (r client) MGetContext(ctx context.Context, keys ...string) (map[string]string, error) {
+	if len(keys) == 0 {
+		return map[string]string{}, nil
+	}
+	if r.cluster() {
+		return do(ctx, func() (map[string]string, error) {
+			cmds, err := r.redisClient.Pipelined(func(pipe redis.Pipeliner) error {
+				for _, key := range keys {
+					pipe.Get(key)
+				}
+				return nil
+			})
+			if err != nil && err != redis.Nil {
+				return nil, err
+			}
+			found := make(map[string]string, len(cmds))
+			for i, cmd := range cmds {
+				if value, err := cmd.(*redis.StringCmd).Result(); err == nil {
+					found[keys[i]] = value
+				}
+			}
+			return found, nil
+		})
+	}
+	return do(ctx, func() (map[string]string, error) {
+		values, err := r.redisClient.MGet(keys...).Result()
+		if err != nil {
+			return nil, err
+		}
+		found := make(map[string]string, len(values))
+		for i, value := range values {
+			if value, ok := value.(string); ok {
+				found[keys[i]] = value
+			}
+		}
+		return found, nil
+	})
+}
+
+func (r client) MSetContext(ctx context.Context, values map[string]interface{}, ttl time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return doErr(ctx, func() error {
+		_, err := r.redisClient.Pipelined(func(pipe redis.Pipeliner) error {
+			for key, value := range values {
+				pipe.Set(key, value, ttl)
+			}
+			return nil
+		})
+		return err
+	})
+}
+
+func (r client) HGetContext(ctx context.Context, key, field string) (string, error) {
+	return do(ctx, func() (string, error) {
+		return r.redisClient.HGet(key, field).Result()
+	})
+}
+
+func (r client) HGetAllContext(ctx context.Context, key string) (map[string]string, error) {
+	return do(ctx, func() (map[string]string, error) {
+		return r.redisClient.HGetAll(key).Result()
+	})
+}
+
+func (r client) HSetContext(ctx context.Context, key string, fields map[string]interface{}) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	return doErr(ctx, func() error {
+		return r.redisClient.HMSet(key, fields).Err()
+	})
+}
+
+func (r client) HDelContext(ctx context.Context, key string, fields ...string) (int64, error) {
+	return do(ctx, func() (int64, error) {
+		return r.redisClient.HDel(key, fields...).Result()
+	})
+}
+
+func (r client) HIncrByContext(ctx context.Context, key, field string, increment int64) (int64, error) {
+	return do(ctx, func() (int64, error) {
+		return r.redisClient.HIncrBy(key, field, increment).Result()
+	})
+}
+
+func (r client) ZAddContext(ctx context.Context, key string, members ...Z) (int64, error) {
+	return do(ctx, func() (int64, error) {
+		return r.redisClient.ZAdd(key, members...).Result()
+	})
+}
+
+func (r client) ZRemContext(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	return do(ctx, func() (int64, error) {
+		return r.redisClient.ZRem(key, members...).Result()
+	})
+}
+
+func (r client) ZScoreContext(ctx context.Context, key, member string) (float64, error) {
+	return do(ctx, func() (float64, error) {
+		return r.redisClient.ZScore(key, member).Result()
+	})
+}
+
+func (r client) ZRangeByScoreContext(ctx context.Context, key, min, max string, offset, count int64) ([]string, error) {
+	return do(ctx, func() ([]string, error) {
+		return r.redisClient.ZRangeByScore(key, redis.ZRangeBy{
+			Min:    min,
+			Max:    max,
+			Offset: offset,
+			Count:  count,
+		}).Result()
+	})
+}
+
+func (r client) ZRevRangeContext(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return do(ctx, func() ([]string, error) {
+		return r.redisClient.ZRevRange(key, start, stop).Result()
+	})
+}
+
+func (r client) TTLContext(ctx context.Context, key string) (time.Duration, error) {
+	return do(ctx, func() (time.Duration, error) {
+		ttl, err := r.redisClient.PTTL(key).Result()
+		if err != nil {
+			return 0, err
+		}
+		// PTTL answers -2 for a missing key and -1 for a key without ttl
+		switch ttl {
+		case -2 * time.Millisecond:
+			return 0, ErrNil
+		case -1 * time.Millisecond:
+			return NoExpiry, nil
+		}
+		return ttl, nil
+	})
+}
+
+func (r client) ExpireContext(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return do(ctx, func() (bool, error) {
+		return r.redisClient.PExpire(key, ttl).Result()
+	})
+}
+
+func (r client) DeletePatternContext(ctx context.Context, pattern string) (int64, error) {
+	cluster, ok := r.redisClient.(*redis.ClusterClient)
+	if !ok {
+		return r.deletePattern(ctx, r.redisClient, pattern)
+	}
+	// SCAN only walks the node it is sent to, so every master is scanned
+	var deleted int64
+	err := cluster.ForEachMaster(func(master *redis.Client) error {
+		n, err := r.deletePattern(ctx, master, pattern)
+		atomic.AddInt64(&deleted, n)
+		return err
+	})
+	return deleted, err
+}
+
+// deletePattern scans node for pattern and deletes the keys found
+func (r client) deletePattern(ctx context.Context, node redis.Cmdable, pattern string) (int64, error) {
+	var deleted int64
+	var cursor uint64
+	for {
+		page, err := do(ctx, func() (scanPage, error) {
+			keys, next, err := node.Scan(cursor, pattern, defaultScanCount).Result()
+			return scanPage{keys: keys, next: next}, err
+		})
+		if err != nil {
+			return deleted, err
+		}
+		n, err := r.DeleteContext(ctx, page.keys...)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+		if page.next == 0 {
+			return deleted, nil
+		}
+		cursor = page.next
+	}
+}
+
+type scanPage struct {
+	keys []string
+	next uint64
+}
+
+// the compare scripts run atomically inside redis, so a key that expires and
+// is taken by another owner between the GET and the write is never touched
+var (
+	compareAndDeleteScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+	compareAndExpireScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+func (r client) CompareAndDeleteContext(ctx context.Context, key, value string) (bool, error) {
+	return do(ctx, func() (bool, error) {
+		n, err := compareAndDeleteScript.Run(r.redisClient, []string{key}, value).Int64()
+		return n == 1, err
+	})
+}
+
+func (r client) CompareAndExpireContext(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return do(ctx, func() (bool, error) {
+		n, err := compareAndExpireScript.Run(r.redisClient, []string{key}, value, ttl.Milliseconds()).Int64()
+		return n == 1, err
+	})
+}
+
+func (r client) PublishContext(ctx context.Context, channel string, message string) error {
+	return doErr(ctx, func() error {
+		return r.redisClient.Publish(channel, message).Err()
+	})
+}
+
+func (r client) SubscribeContext(ctx context.Context, handler func(Message), channels ...string) error {
+	pubSub := r.redisClient.Subscribe(channels...)
+	defer pubSub.Close()
+	// wait for the confirmation so a failing subscription is reported
+	if _, err := do(ctx, func() (interface{}, error) {
+		return pubSub.Receive()
+	}); err != nil {
+		return err
+	}
+
+	messages := pubSub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			handler(Message{Channel: message.Channel, Payload: message.Payload})
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/retry"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	lockKeyPrefix = "lock:"
+	// how long a lock release may take once the work is over
+	lockReleaseTimeout = 5 * time.Second
+)
+
+var (
+	ErrLockHeld = errors.New("lock is held by another owner")
+	ErrLockLost = errors.New("lock is no longer held")
+)
+
+// acquirePolicy paces Acquire while the lock is held elsewhere, it retries
+// until the context is done
+var acquirePolicy = retry.Policy{
+	InitialInterval: 50 * time.Millisecond,
+	MaxInterval:     time.Second,
+}
+
+// Locker hands out locks shared by every replica
+type Locker interface {
+	// TryAcquire takes the lock for ttl, it fails with ErrLockHeld while
+	// another owner holds it
+	TryAcquire(ctx context.Context, name string, ttl time.Duration) (Lock, error)
+}
+
+// Lock is a held lock, only its holder can refresh or release it
+type Lock interface {
+	Name() string
+	// Token identifies the holder, it is unique per acquisition
+	Token() string
+	// Refresh extends the lease to ttl from now, it fails with ErrLockLost
+	// when the lease expired and the lock may have changed hands
+	Refresh(ctx context.Context, ttl time.Duration) error
+	// Release frees the lock, it fails with ErrLockLost when the lock was
+	// no longer held and leaves the new holder untouched
+	Release(ctx context.Context) error
+}
+
+// NewToken returns a random lock token
+func NewToken() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Acquire waits until locker hands out the lock or ctx is done
+func Acquire(ctx context.Context, locker Locker, name string, ttl time.Duration) (Lock, error) {
+	for attempt := 1; ; attempt++ {
+		lock, err := locker.TryAcquire(ctx, name, ttl)
+		if !errors.Is(err, ErrLockHeld) {
+			return lock, err
+		}
+
+		timer := time.NewTimer(retry.Backoff(acquirePolicy, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("acquire lock %s: %w", name, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// WithLock runs fn on the replica that takes the lock, the others get
+// ErrLockHeld without waiting. The lease is renewed every ttl/3 while fn
+// runs, and the ctx of fn is cancelled as soon as the lock is lost.
+func WithLock(ctx context.Context, locker Locker, name string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	lock, err := locker.TryAcquire(ctx, name, ttl)
+	if err != nil {
+		return err
+	}
+	return Hold(ctx, lock, ttl, fn)
+}
+
+// Hold runs fn while renewing a lock taken with a lease of ttl, and releases
+// it once fn returns. It lets a caller answer as soon as the lock is taken
+// and run fn in the background.
+func Hold(ctx context.Context, lock Lock, ttl time.Duration, fn func(ctx context.Context) error) error {
+	name := lock.Name()
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lost := make(chan error, 1)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		interval := ttl / 3
+		if interval <= 0 {
+			interval = ttl
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		// a failed renewal is retried on the next tick, the lock only counts
+		// as lost once the lease it had may have run out
+		leaseUntil := time.Now().Add(ttl)
+		for {
+			select {
+			case <-workCtx.Done():
+				return
+			case <-ticker.C:
+				err := lock.Refresh(workCtx, ttl)
+				if err == nil {
+					leaseUntil = time.Now().Add(ttl)
+					continue
+				}
+				if workCtx.Err() != nil {
+					return
+				}
+				if !errors.Is(err, ErrLockLost) && time.Now().Add(interval).Before(leaseUntil) {
+					log.Warnf("lock %s: renew: %v, retrying", name, err)
+					continue
+				}
+				log.Errorf("lock %s: renew: %v", name, err)
+				lost <- err
+				cancel()
+				return
+			}
+		}
+	}()
+
+	err := fn(workCtx)
+	cancel()
+	<-renewed
+
+	select {
+	case lostErr := <-lost:
+		if err == nil {
+			err = fmt.Errorf("lock %s: %w", name, lostErr)
+		}
+		return err
+	default:
+	}
+
+	// release with a fresh ctx, the caller's may be the reason fn returned
+	releaseCtx, releaseCancel := context.WithTimeout(context.Background(), lockReleaseTimeout)
+	defer releaseCancel()
+	if errRelease := lock.Release(releaseCtx); errRelease != nil {
+		log.Warnf("lock %s: release: %v", name, errRelease)
+	}
+	return err
+}
+
+type redisLocker struct {
+	lib ContextLibInterface
+}
+
+// NewLocker returns a Locker keeping each lock in a key holding the token of
+// its holder, the key expires with the lease
+func NewLocker(lib ContextLibInterface) Locker {
+	return redisLocker{lib: lib}
+}
+
+func (l redisLocker) TryAcquire(ctx context.Context, name string, ttl time.Duration) (Lock, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("lock %s: ttl must be greater than 0, got %s", name, ttl)
+	}
+	token := NewToken()
+	acquired, err := l.lib.SetNXContext(ctx, lockKeyPrefix+name, token, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("acquire lock %s: %w", name, err)
+	}
+	if !acquired {
+		return nil, ErrLockHeld
+	}
+	return &redisLock{lib: l.lib, name: name, token: token}, nil
+}
+
+type redisLock struct {
+	lib   ContextLibInterface
+	name  string
+	token string
+}
+
+func (l *redisLock) Name() string {
+	return l.name
+}
+
+func (l *redisLock) Token() string {
+	return l.token
+}
+
+func (l *redisLock) Refresh(ctx context.Context, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("lock %s: ttl must be greater than 0, got %s", l.name, ttl)
+	}
+	ok, err := l.lib.CompareAndExpireContext(ctx, lockKeyPrefix+l.name, l.token, ttl)
+	if err != nil {
+		return fmt.Errorf("refresh lock %s: %w", l.name, err)
+	}
+	if !ok {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (l *redisLock) Release(ctx context.Context) error {
+	ok, err := l.lib.CompareAndDeleteContext(ctx, lockKeyPrefix+l.name, l.token)
+	if err != nil {
+		return fmt.Errorf("release lock %s: %w", l.name, err)
+	}
+	if !ok {
+		return ErrLockLost
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/redis"
+	"go-bunrouter-gorm-example/infrastructure/redis/redistest"
+)
+
+func TestLockerExcludesOtherOwners(t *testing.T) {
+	ctx := context.Background()
+	locker := redis.NewLocker(redistest.NewFake())
+
+	lock, err := locker.TryAcquire(ctx, "task", time.Minute)
+	if err != nil {
+		t.Fatalf("TryAcquire() error = %v", err)
+	}
+	if _, err = locker.TryAcquire(ctx, "task", time.Minute); !errors.Is(err, redis.ErrLockHeld) {
+		t.Errorf("TryAcquire() of a held lock error = %v, want ErrLockHeld", err)
+	}
+	if _, err = locker.TryAcquire(ctx, "other", time.Minute); err != nil {
+		t.Errorf("TryAcquire() of another lock error = %v", err)
+	}
+
+	if err = lock.Release(ctx); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, err = locker.TryAcquire(ctx, "task", time.Minute); err != nil {
+		t.Errorf("TryAcquire() after Release() error = %v", err)
+	}
+}
+
+func TestLockerExpiredLeaseIsLost(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	fake := redistest.NewFake()
+	fake.SetClock(func() time.Time { return now })
+	locker := redis.NewLocker(fake)
+
+	lock, err := locker.TryAcquire(ctx, "task", time.Minute)
+	if err != nil {
+		t.Fatalf("TryAcquire() error = %v", err)
+	}
+	now = now.Add(30 * time.Second)
+	if err = lock.Refresh(ctx, time.Minute); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	// the refreshed lease outlives the first one
+	now = now.Add(45 * time.Second)
+	if _, err = locker.TryAcquire(ctx, "task", time.Minute); !errors.Is(err, redis.ErrLockHeld) {
+		t.Fatalf("TryAcquire() within the refreshed lease error = %v, want ErrLockHeld", err)
+	}
+
+	now = now.Add(15 * time.Second)
+	next, err := locker.TryAcquire(ctx, "task", time.Minute)
+	if err != nil {
+		t.Fatalf("TryAcquire() after the lease error = %v", err)
+	}
+	if err = lock.Refresh(ctx, time.Minute); !errors.Is(err, redis.ErrLockLost) {
+		t.Errorf("Refresh() of a lost lock error = %v, want ErrLockLost", err)
+	}
+	if err = lock.Release(ctx); !errors.Is(err, redis.ErrLockLost) {
+		t.Errorf("Release() of a lost lock error = %v, want ErrLockLost", err)
+	}
+	// the new holder is left alone
+	if err = next.Release(ctx); err != nil {
+		t.Errorf("Release() by the new holder error = %v", err)
+	}
+}
+
+func TestWithLockSkipsWhileHeld(t *testing.T) {
+	ctx := context.Background()
+	locker := redis.NewLocker(redistest.NewFake())
+
+	ran := false
+	err := redis.WithLock(ctx, locker, "task", time.Minute, func(ctx context.Context) error {
+		errInner := redis.WithLock(ctx, locker, "task", time.Minute, func(ctx context.Context) error {
+			t.Error("WithLock() ran fn while the lock was held")
+			return nil
+		})
+		if !errors.Is(errInner, redis.ErrLockHeld) {
+			t.Errorf("WithLock() of a held lock error = %v, want ErrLockHeld", errInner)
+		}
+		ran = true
+		return nil
+	})
+	if err != nil || !ran {
+		t.Fatalf("WithLock() = %v, ran %t", err, ran)
+	}
+	if _, err = locker.TryAcquire(ctx, "task", time.Minute); err != nil {
+		t.Errorf("TryAcquire() after WithLock() error = %v, want the lock released", err)
+	}
+}
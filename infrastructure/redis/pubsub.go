@@ -0,0 +1,76 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/retry"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// resubscribePolicy spaces out the attempts to subscribe again
+var resubscribePolicy = retry.Policy{
+	InitialInterval: time.Second,
+	MaxInterval:     30 * time.Second,
+}
+
+// InvalidationBus broadcasts changed cache keys to every replica over redis
+// pub/sub, a replica ignores the messages it published itself
+type InvalidationBus struct {
+	lib     ContextLibInterface
+	channel string
+	origin  string
+}
+
+func NewInvalidationBus(lib ContextLibInterface, channel string) *InvalidationBus {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return &InvalidationBus{
+		lib:     lib,
+		channel: channel,
+		origin:  hex.EncodeToString(buf),
+	}
+}
+
+func (b *InvalidationBus) Publish(key string) error {
+	return b.lib.PublishContext(context.Background(), b.channel, b.origin+" "+key)
+}
+
+// Subscribe calls fn with every key changed by another replica until ctx is
+// done. go-redis resubscribes by itself after a connection loss, a failed
+// subscription, e.g. while the breaker is open, is retried with a backoff.
+func (b *InvalidationBus) Subscribe(ctx context.Context, fn func(key string)) {
+	attempt := 0
+	for ctx.Err() == nil {
+		started := time.Now()
+		err := b.lib.SubscribeContext(ctx, func(message Message) {
+			origin, key, found := strings.Cut(message.Payload, " ")
+			if !found || origin == b.origin {
+				return
+			}
+			fn(key)
+		}, b.channel)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+
+		//a subscription that held for a while starts the backoff over
+		if time.Since(started) > resubscribePolicy.MaxInterval {
+			attempt = 0
+		}
+		attempt++
+		wait := retry.Backoff(resubscribePolicy, attempt)
+		log.Errorf("redis: subscribe to %s: %v, retrying in %s", b.channel, err, wait.Round(time.Millisecond))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package redis
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"go-bunrouter-gorm-example/infrastructure/config"
@@ -16,30 +20,97 @@ var (
 )
 
 // NewRedisLibInterface initialize a redis client
-func NewRedisLibInterface(redisClient *redis.Client) (redisLib LibInterface, err error) {
+func NewRedisLibInterface(redisClient redis.UniversalClient) (redisLib ContextLibInterface, err error) {
 	_, err = redisClient.Ping().Result()
 	if err != nil {
-		log.Fatalf("Open connection to redis, error: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("open connection to redis: %w", err)
 	}
 	redisLib = newLib(redisClient)
-	log.Printf("Connected to redis on %s (DB: %d)", config.Conf.Redis.Host, config.Conf.Redis.DB)
+	log.Printf("Connected to redis in %s mode on %s (DB: %d)", config.Conf.Redis.Mode, strings.Join(addrs(config.Conf.Redis), ","), config.Conf.Redis.DB)
 	return redisLib, nil
 }
 
-// NewRedisClient initialize a redis client
-func NewRedisClient(conf *config.Config) (redisClient *redis.Client, err error) {
-	redisClient = redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", config.Conf.Redis.Host, config.Conf.Redis.Port),
-		Password: conf.Redis.Password,
-		DB:       conf.Redis.DB,
-	})
+// NewRedisClient initialize a redis client for the configured mode, a
+// standalone node, a master found through sentinels or a cluster
+func NewRedisClient(conf *config.Config) (redisClient redis.UniversalClient, err error) {
+	tlsConfig, err := newTLSConfig(conf.Redis.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	switch conf.Redis.Mode {
+	case config.RedisModeSentinel:
+		redisClient = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    conf.Redis.MasterName,
+			SentinelAddrs: conf.Redis.Addrs,
+			Password:      conf.Redis.Password,
+			DB:            conf.Redis.DB,
+			PoolSize:      conf.Redis.PoolSize,
+			DialTimeout:   conf.Redis.DialTimeout,
+			ReadTimeout:   conf.Redis.ReadTimeout,
+			WriteTimeout:  conf.Redis.WriteTimeout,
+			TLSConfig:     tlsConfig,
+		})
+	case config.RedisModeCluster:
+		redisClient = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        conf.Redis.Addrs,
+			Password:     conf.Redis.Password,
+			PoolSize:     conf.Redis.PoolSize,
+			DialTimeout:  conf.Redis.DialTimeout,
+			ReadTimeout:  conf.Redis.ReadTimeout,
+			WriteTimeout: conf.Redis.WriteTimeout,
+			TLSConfig:    tlsConfig,
+		})
+	default:
+		redisClient = redis.NewClient(&redis.Options{
+			Addr:         addrs(conf.Redis)[0],
+			Password:     conf.Redis.Password,
+			DB:           conf.Redis.DB,
+			PoolSize:     conf.Redis.PoolSize,
+			DialTimeout:  conf.Redis.DialTimeout,
+			ReadTimeout:  conf.Redis.ReadTimeout,
+			WriteTimeout: conf.Redis.WriteTimeout,
+			TLSConfig:    tlsConfig,
+		})
+	}
 
 	return redisClient, nil
 }
 
+// addrs returns the addresses the client dials first
+func addrs(conf config.RedisConfig) []string {
+	if conf.Mode == config.RedisModeStandalone || conf.Mode == "" {
+		return []string{fmt.Sprintf("%s:%d", conf.Host, conf.Port)}
+	}
+	return conf.Addrs
+}
+
+// newTLSConfig returns nil when TLS is disabled
+func newTLSConfig(conf config.RedisTLSConfig) (*tls.Config, error) {
+	if !conf.Enabled {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         conf.ServerName,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+	if conf.CAFile != "" {
+		pem, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("redis CA file %s holds no PEM certificate", conf.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
 type client struct {
-	redisClient *redis.Client
+	redisClient redis.UniversalClient
 }
 
 type LibInterface interface {
@@ -47,19 +118,19 @@ type LibInterface interface {
 	DeleteKey(key string) (err error)
 	Get(key string) (value string)
 	Set(key string, value interface{}, ttl time.Duration) (err error)
+	Incr(key string) (value int64, err error)
+	SetNX(key string, value interface{}, ttl time.Duration) (ok bool, err error)
 }
 
-func newLib(redisClient *redis.Client) LibInterface {
+func newLib(redisClient redis.UniversalClient) ContextLibInterface {
 	return client{
 		redisClient: redisClient,
 	}
 }
 
+// SetIdempotencyKey claims key, it fails with ErrMultipleKeyInCache when
+// the key is already claimed
 func (r client) SetIdempotencyKey(key string, value interface{}, ttl time.Duration) (err error) {
-	valueInRedis := r.redisClient.Get(key).Val()
-	if len(valueInRedis) > 0 {
-		return
-	}
 	success, err := r.redisClient.SetNX(key, value, ttl).Result()
 	if err != nil {
 		return
@@ -83,6 +154,18 @@ func (r client) Get(key string) string {
 	return r.redisClient.Get(key).Val()
 }
 
+func (r client) Incr(key string) (int64, error) {
+	return r.redisClient.Incr(key).Result()
+}
+
+func (r client) SetNX(key string, value interface{}, ttl time.Duration) (bool, error) {
+	return r.redisClient.SetNX(key, value, ttl).Result()
+}
+
+func (r client) getWithError(key string) (string, error) {
+	return r.redisClient.Get(key).Result()
+}
+
 func (r client) Set(key string, value interface{}, ttl time.Duration) error {
 	return r.redisClient.Set(key, value, ttl).Err()
 }
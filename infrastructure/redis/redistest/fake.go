@@ -0,0 +1,623 @@
+// Package redistest provides an in-memory stand-in for the redis library,
+// meant for tests and local tooling that should not need a redis server.
+package redistest
+
+import (
+	"context"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/redis"
+)
+
+var _ redis.ContextLibInterface = (*Fake)(nil)
+
+type entry struct {
+	value     string
+	hash      map[string]string
+	zset      map[string]float64
+	expiresAt time.Time
+}
+
+// Fake keeps every key in memory, it honours ttls, hashes, sorted sets and
+// pub/sub within the process. The zero value is not usable, use NewFake.
+type Fake struct {
+	mu          sync.Mutex
+	now         func() time.Time
+	data        map[string]*entry
+	subscribers map[string][]chan redis.Message
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		now:         time.Now,
+		data:        make(map[string]*entry),
+		subscribers: make(map[string][]chan redis.Message),
+	}
+}
+
+// SetClock replaces the clock used for ttls, tests use it to expire keys
+// without sleeping
+func (f *Fake) SetClock(now func() time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+}
+
+// lookup returns the live entry of key, expired entries are dropped, the
+// caller holds the lock
+func (f *Fake) lookup(key string) *entry {
+	e, ok := f.data[key]
+	if !ok {
+		return nil
+	}
+	if !e.expiresAt.IsZero() && !f.now().Before(e.expiresAt) {
+		delete(f.data, key)
+		return nil
+	}
+	return e
+}
+
+func (f *Fake) expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return f.now().Add(ttl)
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	default:
+		if s, ok := v.(interface{ String() string }); ok {
+			return s.String()
+		}
+		return ""
+	}
+}
+
+func (f *Fake) SetIdempotencyKey(key string, value interface{}, ttl time.Duration) error {
+	ok, err := f.SetNX(key, value, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return redis.ErrMultipleKeyInCache
+	}
+	return nil
+}
+
+func (f *Fake) DeleteKey(key string) error {
+	_, err := f.DeleteContext(context.Background(), key)
+	return err
+}
+
+func (f *Fake) Get(key string) (value string) {
+	value, _ = f.GetContext(context.Background(), key)
+	return value
+}
+
+func (f *Fake) Set(key string, value interface{}, ttl time.Duration) error {
+	return f.SetContext(context.Background(), key, value, ttl)
+}
+
+func (f *Fake) Incr(key string) (int64, error) {
+	return f.IncrContext(context.Background(), key)
+}
+
+func (f *Fake) SetNX(key string, value interface{}, ttl time.Duration) (bool, error) {
+	return f.SetNXContext(context.Background(), key, value, ttl)
+}
+
+func (f *Fake) GetContext(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := f.lookup(key)
+	if e == nil || e.hash != nil || e.zset != nil {
+		return "", redis.ErrNil
+	}
+	return e.value, nil
+}
+
+func (f *Fake) SetContext(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data[key] = &entry{value: toString(value), expiresAt: f.expiry(ttl)}
+	return nil
+}
+
+func (f *Fake) SetNXContext(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lookup(key) != nil {
+		return false, nil
+	}
+	f.data[key] = &entry{value: toString(value), expiresAt: f.expiry(ttl)}
+	return true, nil
+}
+
+func (f *Fake) DeleteContext(ctx context.Context, keys ...string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var deleted int64
+	for _, key := range keys {
+		if f.lookup(key) != nil {
+			delete(f.data, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (f *Fake) IncrContext(ctx context.Context, key string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := f.lookup(key)
+	if e == nil {
+		e = &entry{value: "0"}
+		f.data[key] = e
+	}
+	current, err := strconv.ParseInt(e.value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	current++
+	e.value = strconv.FormatInt(current, 10)
+	return current, nil
+}
+
+func (f *Fake) MGetContext(ctx context.Context, keys ...string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if e := f.lookup(key); e != nil && e.hash == nil && e.zset == nil {
+			values[key] = e.value
+		}
+	}
+	return values, nil
+}
+
+func (f *Fake) MSetContext(ctx context.Context, values map[string]interface{}, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, value := range values {
+		f.data[key] = &entry{value: toString(value), expiresAt: f.expiry(ttl)}
+	}
+	return nil
+}
+
+func (f *Fake) HGetContext(ctx context.Context, key, field string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := f.lookup(key)
+	if e == nil || e.hash == nil {
+		return "", redis.ErrNil
+	}
+	value, ok := e.hash[field]
+	if !ok {
+		return "", redis.ErrNil
+	}
+	return value, nil
+}
+
+func (f *Fake) HGetAllContext(ctx context.Context, key string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	values := make(map[string]string)
+	if e := f.lookup(key); e != nil {
+		for field, value := range e.hash {
+			values[field] = value
+		}
+	}
+	return values, nil
+}
+
+// hashEntry returns the hash stored at key, creating it, the caller holds
+// the lock
+func (f *Fake) hashEntry(key string) *entry {
+	e := f.lookup(key)
+	if e == nil || e.hash == nil {
+		e = &entry{hash: make(map[string]string)}
+		f.data[key] = e
+	}
+	return e
+}
+
+func (f *Fake) HSetContext(ctx context.Context, key string, fields map[string]interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := f.hashEntry(key)
+	for field, value := range fields {
+		e.hash[field] = toString(value)
+	}
+	return nil
+}
+
+func (f *Fake) HDelContext(ctx context.Context, key string, fields ...string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := f.lookup(key)
+	if e == nil || e.hash == nil {
+		return 0, nil
+	}
+	var deleted int64
+	for _, field := range fields {
+		if _, ok := e.hash[field]; ok {
+			delete(e.hash, field)
+			deleted++
+		}
+	}
+	if len(e.hash) == 0 {
+		delete(f.data, key)
+	}
+	return deleted, nil
+}
+
+func (f *Fake) HIncrByContext(ctx context.Context, key, field string, increment int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := f.hashEntry(key)
+	current := int64(0)
+	if value, ok := e.hash[field]; ok {
+		var err error
+		if current, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return 0, err
+		}
+	}
+	current += increment
+	e.hash[field] = strconv.FormatInt(current, 10)
+	return current, nil
+}
+
+func (f *Fake) ZAddContext(ctx context.Context, key string, members ...redis.Z) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := f.lookup(key)
+	if e == nil || e.zset == nil {
+		e = &entry{zset: make(map[string]float64)}
+		f.data[key] = e
+	}
+	var added int64
+	for _, member := range members {
+		name := toString(member.Member)
+		if _, ok := e.zset[name]; !ok {
+			added++
+		}
+		e.zset[name] = member.Score
+	}
+	return added, nil
+}
+
+func (f *Fake) ZRemContext(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := f.lookup(key)
+	if e == nil || e.zset == nil {
+		return 0, nil
+	}
+	var removed int64
+	for _, member := range members {
+		name := toString(member)
+		if _, ok := e.zset[name]; ok {
+			delete(e.zset, name)
+			removed++
+		}
+	}
+	if len(e.zset) == 0 {
+		delete(f.data, key)
+	}
+	return removed, nil
+}
+
+func (f *Fake) ZScoreContext(ctx context.Context, key, member string) (float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := f.lookup(key)
+	if e == nil || e.zset == nil {
+		return 0, redis.ErrNil
+	}
+	score, ok := e.zset[member]
+	if !ok {
+		return 0, redis.ErrNil
+	}
+	return score, nil
+}
+
+// sorted returns the members of the sorted set at key by ascending score
+// then member, the caller holds the lock
+func (f *Fake) sorted(key string) []redis.Z {
+	e := f.lookup(key)
+	if e == nil || e.zset == nil {
+		return nil
+	}
+	members := make([]redis.Z, 0, len(e.zset))
+	for member, score := range e.zset {
+		members = append(members, redis.Z{Score: score, Member: member})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Score != members[j].Score {
+			return members[i].Score < members[j].Score
+		}
+		return members[i].Member.(string) < members[j].Member.(string)
+	})
+	return members
+}
+
+// parseBound parses a ZRANGEBYSCORE bound, a "(" prefix makes it exclusive
+func parseBound(bound string) (value float64, exclusive bool, err error) {
+	if len(bound) > 0 && bound[0] == '(' {
+		exclusive = true
+		bound = bound[1:]
+	}
+	switch bound {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+	value, err = strconv.ParseFloat(bound, 64)
+	return value, exclusive, err
+}
+
+func (f *Fake) ZRangeByScoreContext(ctx context.Context, key, min, max string, offset, count int64) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	minValue, minExclusive, err := parseBound(min)
+	if err != nil {
+		return nil, err
+	}
+	maxValue, maxExclusive, err := parseBound(max)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	result := make([]string, 0)
+	var skipped int64
+	for _, member := range f.sorted(key) {
+		if member.Score < minValue || (minExclusive && member.Score == minValue) {
+			continue
+		}
+		if member.Score > maxValue || (maxExclusive && member.Score == maxValue) {
+			continue
+		}
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		if count > 0 && int64(len(result)) >= count {
+			break
+		}
+		result = append(result, member.Member.(string))
+	}
+	return result, nil
+}
+
+func (f *Fake) ZRevRangeContext(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	members := f.sorted(key)
+	size := int64(len(members))
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	result := make([]string, 0)
+	for rank := start; rank <= stop; rank++ {
+		result = append(result, members[size-1-rank].Member.(string))
+	}
+	return result, nil
+}
+
+func (f *Fake) TTLContext(ctx context.Context, key string) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := f.lookup(key)
+	if e == nil {
+		return 0, redis.ErrNil
+	}
+	if e.expiresAt.IsZero() {
+		return redis.NoExpiry, nil
+	}
+	return e.expiresAt.Sub(f.now()), nil
+}
+
+func (f *Fake) ExpireContext(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := f.lookup(key)
+	if e == nil {
+		return false, nil
+	}
+	if ttl <= 0 {
+		delete(f.data, key)
+		return true, nil
+	}
+	e.expiresAt = f.now().Add(ttl)
+	return true, nil
+}
+
+// DeletePatternContext matches with path.Match, which covers the *, ? and
+// [...] globs redis supports
+func (f *Fake) DeletePatternContext(ctx context.Context, pattern string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var deleted int64
+	for key := range f.data {
+		matched, err := path.Match(pattern, key)
+		if err != nil {
+			return deleted, err
+		}
+		if matched && f.lookup(key) != nil {
+			delete(f.data, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (f *Fake) CompareAndDeleteContext(ctx context.Context, key, value string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := f.lookup(key)
+	if e == nil || e.hash != nil || e.zset != nil || e.value != value {
+		return false, nil
+	}
+	delete(f.data, key)
+	return true, nil
+}
+
+func (f *Fake) CompareAndExpireContext(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := f.lookup(key)
+	if e == nil || e.hash != nil || e.zset != nil || e.value != value {
+		return false, nil
+	}
+	if ttl <= 0 {
+		delete(f.data, key)
+		return true, nil
+	}
+	e.expiresAt = f.now().Add(ttl)
+	return true, nil
+}
+
+func (f *Fake) PublishContext(ctx context.Context, channel string, message string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, subscriber := range f.subscribers[channel] {
+		// a slow subscriber misses messages like a redis client that fell
+		// behind, publishing never blocks
+		select {
+		case subscriber <- redis.Message{Channel: channel, Payload: message}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (f *Fake) SubscribeContext(ctx context.Context, handler func(redis.Message), channels ...string) error {
+	messages := make(chan redis.Message, 64)
+	f.mu.Lock()
+	for _, channel := range channels {
+		f.subscribers[channel] = append(f.subscribers[channel], messages)
+	}
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, channel := range channels {
+			subscribers := f.subscribers[channel]
+			for i, subscriber := range subscribers {
+				if subscriber == messages {
+					f.subscribers[channel] = append(subscribers[:i], subscribers[i+1:]...)
+					break
+				}
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message := <-messages:
+			handler(message)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMaxAttempts     = 1
+	defaultInitialInterval = 500 * time.Millisecond
+	defaultMaxInterval     = 10 * time.Second
+)
+
+// Policy bounds an exponential backoff, the wait before attempt n is a
+// random duration between half and all of min(MaxInterval, InitialInterval*2^n)
+type Policy struct {
+	MaxAttempts     int
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// MaxElapsed stops retrying once the total time spent would exceed it,
+	// zero means only MaxAttempts applies
+	MaxElapsed time.Duration
+}
+
+// Do calls fn until it succeeds, the policy is exhausted or ctx is done.
+// Every failed attempt is logged with its reason.
+func Do(ctx context.Context, name string, policy Policy, fn func(ctx context.Context) error) error {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = defaultMaxAttempts
+	}
+	if policy.InitialInterval <= 0 {
+		policy.InitialInterval = defaultInitialInterval
+	}
+	if policy.MaxInterval <= 0 {
+		policy.MaxInterval = defaultMaxInterval
+	}
+
+	start := time.Now()
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil {
+			if attempt > 1 {
+				log.Infof("%s: succeeded on attempt %d/%d", name, attempt, policy.MaxAttempts)
+			}
+			return nil
+		}
+		if attempt >= policy.MaxAttempts {
+			log.Errorf("%s: attempt %d/%d failed: %v, giving up", name, attempt, policy.MaxAttempts, err)
+			return fmt.Errorf("%s failed after %d attempt(s): %w", name, attempt, err)
+		}
+
+		wait := Backoff(policy, attempt)
+		if policy.MaxElapsed > 0 && time.Since(start)+wait > policy.MaxElapsed {
+			log.Errorf("%s: attempt %d/%d failed: %v, giving up after %s", name, attempt, policy.MaxAttempts, err, time.Since(start).Round(time.Millisecond))
+			return fmt.Errorf("%s failed after %d attempt(s) in %s: %w", name, attempt, time.Since(start).Round(time.Millisecond), err)
+		}
+		log.Warnf("%s: attempt %d/%d failed: %v, retrying in %s", name, attempt, policy.MaxAttempts, err, wait.Round(time.Millisecond))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s cancelled after %d attempt(s): %w", name, attempt, err)
+		case <-timer.C:
+		}
+	}
+}
+
+// Backoff returns the jittered wait after the given failed attempt, half of
+// it is fixed so the wait still grows with the attempts
+func Backoff(policy Policy, attempt int) time.Duration {
+	ceiling := float64(policy.InitialInterval) * math.Pow(2, float64(attempt-1))
+	if ceiling > float64(policy.MaxInterval) || math.IsInf(ceiling, 0) {
+		ceiling = float64(policy.MaxInterval)
+	}
+	half := int64(ceiling) / 2
+	return time.Duration(half + rand.Int63n(int64(ceiling)-half+1))
+}
@@ -0,0 +1,83 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoffBounds(t *testing.T) {
+	policy := Policy{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second}
+
+	tests := []struct {
+		attempt int
+		ceiling time.Duration
+	}{
+		{attempt: 1, ceiling: 100 * time.Millisecond},
+		{attempt: 2, ceiling: 200 * time.Millisecond},
+		{attempt: 4, ceiling: 800 * time.Millisecond},
+		{attempt: 5, ceiling: time.Second},
+		{attempt: 64, ceiling: time.Second},
+		{attempt: 2000, ceiling: time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 200; i++ {
+			wait := Backoff(policy, tt.attempt)
+			if wait < tt.ceiling/2 || wait > tt.ceiling {
+				t.Fatalf("Backoff(attempt %d) = %s, want between %s and %s", tt.attempt, wait, tt.ceiling/2, tt.ceiling)
+			}
+		}
+	}
+}
+
+func TestDoGivesUpAfterMaxAttempts(t *testing.T) {
+	policy := Policy{MaxAttempts: 3, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond}
+	errFail := errors.New("down")
+
+	calls := 0
+	err := Do(context.Background(), "test", policy, func(ctx context.Context) error {
+		calls++
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Errorf("Do() error = %v, want it to wrap %v", err, errFail)
+	}
+	if calls != 3 {
+		t.Errorf("Do() called fn %d times, want 3", calls)
+	}
+}
+
+func TestDoStopsOnSuccess(t *testing.T) {
+	policy := Policy{MaxAttempts: 5, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond}
+
+	calls := 0
+	err := Do(context.Background(), "test", policy, func(ctx context.Context) error {
+		calls++
+		if calls < 2 {
+			return errors.New("down")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Do() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Do() called fn %d times, want 2", calls)
+	}
+}
+
+func TestDoStopsWhenCancelled(t *testing.T) {
+	policy := Policy{MaxAttempts: 5, InitialInterval: time.Hour, MaxInterval: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := Do(ctx, "test", policy, func(ctx context.Context) error {
+		calls++
+		return errors.New("down")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Do() = %v after %d call(s), want an error after 1", err, calls)
+	}
+}
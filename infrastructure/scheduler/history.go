@@ -0,0 +1,130 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+// runColumns are read for every run
+const runColumns = `id, task, trigger, status, replica, scheduled_at, started_at, finished_at, result, error`
+
+// start records a run of task. It runs under the lock of the task, so any
+// other run still marked running was left by a replica that stopped and is
+// abandoned. A scheduled run is not claimed when another replica already
+// ran its slot.
+func (s *Scheduler) start(ctx context.Context, task, trigger string, scheduledAt time.Time) (Run, bool, error) {
+	_, err := s.db.ExecContext(ctx, `update schedule_runs set status = $2, finished_at = now(), error = $3
+	where task = $1 and status = $4`, task, StatusAbandoned, "the replica running it stopped before it finished", StatusRunning)
+	if err != nil {
+		return Run{}, false, fmt.Errorf("start %s: %w", task, err)
+	}
+
+	run, err := scanRun(s.db.QueryRowContext(ctx, `insert into schedule_runs (task, trigger, status, replica, scheduled_at)
+	values ($1, $2, $3, $4, $5)
+	on conflict (task, scheduled_at) where trigger = 'schedule' do nothing
+	returning `+runColumns, task, trigger, StatusRunning, s.replica, scheduledAt))
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Debugf("scheduler: %s already ran its %s slot", task, scheduledAt.Format(time.RFC3339))
+		return Run{}, false, nil
+	}
+	if err != nil {
+		return Run{}, false, fmt.Errorf("start %s: %w", task, err)
+	}
+
+	//the history is pruned as it grows, a failure only delays it
+	_, err = s.db.ExecContext(ctx, `delete from schedule_runs
+	where task = $1 and started_at < now() - $2::float8 * interval '1 millisecond'`, task, s.settings.HistoryRetention.Milliseconds())
+	if err != nil {
+		log.Warnf("scheduler: prune the history of %s: %v", task, err)
+	}
+	return run, true, nil
+}
+
+// finish records the outcome of a run, result is marshalled to json
+func (s *Scheduler) finish(ctx context.Context, run Run, status string, result interface{}, message string) error {
+	var resultJSON interface{}
+	if result != nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("result: %w", err)
+		}
+		resultJSON = string(data)
+	}
+	_, err := s.db.ExecContext(ctx, `update schedule_runs set status = $2, finished_at = now(), result = $3, error = $4
+	where id = $1 and status = $5`, run.ID, status, resultJSON, message, StatusRunning)
+	return err
+}
+
+// lastRuns reads the latest run of each task
+func (s *Scheduler) lastRuns(ctx context.Context, tasks []string) (map[string]Run, error) {
+	rows, err := s.db.QueryContext(ctx, `select distinct on (task) `+runColumns+` from schedule_runs
+	where task = any($1) order by task, id desc`, pq.Array(tasks))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]Run, len(tasks))
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		result[run.Task] = run
+	}
+	return result, rows.Err()
+}
+
+// Runs reads the runs of a task newest first, along with how many there are
+func (s *Scheduler) Runs(ctx context.Context, filter Filter) ([]Run, int64, error) {
+	var count int64
+	if err := s.db.QueryRowContext(ctx, `select count(*) from schedule_runs where task = $1`, filter.Task).Scan(&count); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `select `+runColumns+` from schedule_runs
+	where task = $1 order by id desc limit $2 offset $3`, filter.Task, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := make([]Run, 0, filter.Limit)
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, run)
+	}
+	return list, count, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRun(row scanner) (Run, error) {
+	var run Run
+	var result []byte
+	var finishedAt sql.NullTime
+	err := row.Scan(&run.ID, &run.Task, &run.Trigger, &run.Status, &run.Replica, &run.ScheduledAt, &run.StartedAt,
+		&finishedAt, &result, &run.Error)
+	if err != nil {
+		return Run{}, err
+	}
+	if finishedAt.Valid {
+		run.FinishedAt = &finishedAt.Time
+	}
+	if result != nil {
+		run.Result = json.RawMessage(result)
+	}
+	return run, nil
+}
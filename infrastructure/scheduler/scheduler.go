@@ -0,0 +1,391 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/redis"
+	"go-bunrouter-gorm-example/utils"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	// StatusAbandoned is a run whose replica stopped before recording its
+	// outcome, it is found by the next run of the task
+	StatusAbandoned = "abandoned"
+
+	defaultLockTTL          = time.Minute
+	defaultHistoryRetention = 30 * 24 * time.Hour
+
+	// lockPrefix namespaces the locks of the tasks
+	lockPrefix = "schedule:"
+
+	// finishTimeout bounds the update recording the outcome of a run, it
+	// runs on a fresh ctx since the task ctx may be why the task returned
+	finishTimeout = 5 * time.Second
+)
+
+var (
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrTaskRunning rejects a run now while a replica runs the task
+	ErrTaskRunning = errors.New("task is already running")
+	// ErrNotRunning rejects a run now before the scheduler started or once
+	// it is shutting down
+	ErrNotRunning = errors.New("scheduler is not running")
+)
+
+// TaskFunc runs a task once, its result is kept in the run history
+type TaskFunc func(ctx context.Context) (result interface{}, err error)
+
+// Task is a recurring task
+type Task struct {
+	Name     string
+	Schedule utils.Cron
+	// Enabled tasks run on their schedule, every task can be run now
+	Enabled bool
+	// Jitter delays each scheduled run by a random duration up to it
+	Jitter time.Duration
+	// Timeout cancels the ctx of a run that takes longer, 0 lifts it
+	Timeout time.Duration
+	Run     TaskFunc
+}
+
+// Settings tune a Scheduler, a zero field takes its default
+type Settings struct {
+	// Location is the time zone of the schedules, UTC when nil
+	Location *time.Location
+	// LockTTL is the lease of the lock held while a task runs, it is
+	// renewed every third of it
+	LockTTL time.Duration
+	// HistoryRetention is how long the runs of a task are kept
+	HistoryRetention time.Duration
+}
+
+// Run is a run of a task, as stored in the history
+type Run struct {
+	ID      int64
+	Task    string
+	Trigger string
+	Status  string
+	Replica string
+	// ScheduledAt is the slot of a scheduled run, or when a manual run was
+	// asked for
+	ScheduledAt time.Time
+	StartedAt   time.Time
+	FinishedAt  *time.Time
+	Result      json.RawMessage
+	Error       string
+}
+
+// TaskInfo describes a registered task
+type TaskInfo struct {
+	Name     string
+	Schedule string
+	Enabled  bool
+	Jitter   time.Duration
+	Timeout  time.Duration
+	// NextRunAt is the next slot of an enabled task
+	NextRunAt *time.Time
+	LastRun   *Run
+}
+
+// Filter selects the runs of Runs
+type Filter struct {
+	Task   string
+	Limit  int
+	Offset int
+}
+
+// Scheduler runs recurring tasks on their cron schedule. Every replica runs
+// the scheduler, a distributed lock keeps a task on a single replica at a
+// time and the run history lets a single replica run each slot.
+type Scheduler struct {
+	db       *sql.DB
+	locker   redis.Locker
+	settings Settings
+	replica  string
+
+	mu    sync.Mutex
+	tasks map[string]*Task
+	// ctx is the ctx given to Run, it is nil until Run starts and once it
+	// is shutting down
+	ctx context.Context
+	// runs tracks the runs started by Trigger
+	runs    sync.WaitGroup
+	running bool
+}
+
+func New(db *sql.DB, locker redis.Locker, settings Settings) *Scheduler {
+	if settings.Location == nil {
+		settings.Location = time.UTC
+	}
+	if settings.LockTTL <= 0 {
+		settings.LockTTL = defaultLockTTL
+	}
+	if settings.HistoryRetention <= 0 {
+		settings.HistoryRetention = defaultHistoryRetention
+	}
+	hostname, _ := os.Hostname()
+	return &Scheduler{
+		db:       db,
+		locker:   locker,
+		settings: settings,
+		replica:  fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		tasks:    make(map[string]*Task),
+	}
+}
+
+// Register adds a task, it must be called before Run
+func (s *Scheduler) Register(task Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		panic(fmt.Sprintf("scheduler: register %s after the scheduler started", task.Name))
+	}
+	s.tasks[task.Name] = &task
+}
+
+// Run runs the enabled tasks on their schedule and blocks until ctx is done,
+// the scheduled and manual runs in progress are cancelled and waited for
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.running = true
+	s.ctx = ctx
+	tasks := make([]*Task, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		if task.Enabled {
+			tasks = append(tasks, task)
+		}
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task *Task) {
+			defer wg.Done()
+			s.loop(ctx, task)
+		}(task)
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	s.ctx = nil
+	s.mu.Unlock()
+	s.runs.Wait()
+}
+
+// loop runs task at each of its slots. A slot whose lock is held, e.g. by a
+// run of the previous slot that is still going, is skipped.
+func (s *Scheduler) loop(ctx context.Context, task *Task) {
+	for {
+		slot := task.Schedule.Next(time.Now().In(s.settings.Location))
+		if slot.IsZero() {
+			log.Warnf("scheduler: %s never runs, %q matches no time", task.Name, task.Schedule)
+			return
+		}
+		delay := time.Until(slot) + jitter(task.Jitter)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		err := redis.WithLock(ctx, s.locker, lockPrefix+task.Name, s.settings.LockTTL, func(ctx context.Context) error {
+			run, claimed, err := s.start(ctx, task.Name, TriggerSchedule, slot)
+			if err != nil || !claimed {
+				return err
+			}
+			s.execute(ctx, task, run)
+			return nil
+		})
+		switch {
+		case errors.Is(err, redis.ErrLockHeld):
+			log.Debugf("scheduler: %s is running on another replica, skipping the %s run", task.Name, slot.Format(time.RFC3339))
+		case err != nil && ctx.Err() == nil:
+			log.Errorf("scheduler: %s: %v", task.Name, err)
+		}
+	}
+}
+
+// Trigger starts a run of task now, on this replica and whether the task is
+// enabled or not. It answers once the run started, the run goes on in the
+// background.
+func (s *Scheduler) Trigger(ctx context.Context, name string) (Run, error) {
+	s.mu.Lock()
+	task, ok := s.tasks[name]
+	started := s.ctx != nil
+	s.mu.Unlock()
+	if !ok {
+		return Run{}, ErrTaskNotFound
+	}
+	if !started {
+		return Run{}, ErrNotRunning
+	}
+
+	lock, err := s.locker.TryAcquire(ctx, lockPrefix+name, s.settings.LockTTL)
+	if errors.Is(err, redis.ErrLockHeld) {
+		return Run{}, ErrTaskRunning
+	}
+	if err != nil {
+		return Run{}, err
+	}
+
+	run, _, err := s.start(ctx, name, TriggerManual, time.Now())
+	if err != nil {
+		release(lock)
+		return Run{}, err
+	}
+
+	//the scheduler may have started shutting down meanwhile
+	s.mu.Lock()
+	base := s.ctx
+	if base != nil {
+		s.runs.Add(1)
+	}
+	s.mu.Unlock()
+	if base == nil {
+		s.record(run, func(ctx context.Context) error {
+			return s.finish(ctx, run, StatusAbandoned, nil, ErrNotRunning.Error())
+		})
+		release(lock)
+		return Run{}, ErrNotRunning
+	}
+
+	go func() {
+		defer s.runs.Done()
+		_ = redis.Hold(base, lock, s.settings.LockTTL, func(ctx context.Context) error {
+			s.execute(ctx, task, run)
+			return nil
+		})
+	}()
+	return run, nil
+}
+
+// release gives up a lock on a fresh ctx
+func release(lock redis.Lock) {
+	ctx, cancel := context.WithTimeout(context.Background(), finishTimeout)
+	defer cancel()
+	if err := lock.Release(ctx); err != nil {
+		log.Warnf("scheduler: release %s: %v", lock.Name(), err)
+	}
+}
+
+// execute runs a claimed run of task and records its outcome
+func (s *Scheduler) execute(ctx context.Context, task *Task, run Run) {
+	runCtx := ctx
+	if task.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, task.Timeout)
+		defer cancel()
+	}
+
+	started := time.Now()
+	result, err := call(runCtx, task)
+	elapsed := time.Since(started).Round(time.Millisecond)
+
+	status, message := StatusSucceeded, ""
+	if err != nil {
+		status, message = StatusFailed, err.Error()
+		log.Errorf("scheduler: %s %s run failed after %s: %v", task.Name, run.Trigger, elapsed, err)
+	} else {
+		log.Infof("scheduler: %s %s run succeeded in %s", task.Name, run.Trigger, elapsed)
+	}
+
+	s.record(run, func(ctx context.Context) error {
+		return s.finish(ctx, run, status, result, message)
+	})
+}
+
+// call runs the task, a panic fails the run like an error
+func call(ctx context.Context, task *Task) (result interface{}, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("task panicked: %v", recovered)
+		}
+	}()
+	return task.Run(ctx)
+}
+
+// record runs the update ending a run on a fresh ctx
+func (s *Scheduler) record(run Run, fn func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), finishTimeout)
+	defer cancel()
+	if err := fn(ctx); err != nil {
+		log.Errorf("scheduler: record %s run %d: %v", run.Task, run.ID, err)
+	}
+}
+
+// Tasks describes the registered tasks ordered by name, with their last run
+func (s *Scheduler) Tasks(ctx context.Context) ([]TaskInfo, error) {
+	s.mu.Lock()
+	list := make([]TaskInfo, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		info := TaskInfo{
+			Name:     task.Name,
+			Schedule: task.Schedule.String(),
+			Enabled:  task.Enabled,
+			Jitter:   task.Jitter,
+			Timeout:  task.Timeout,
+		}
+		if task.Enabled {
+			if next := task.Schedule.Next(time.Now().In(s.settings.Location)); !next.IsZero() {
+				info.NextRunAt = &next
+			}
+		}
+		list = append(list, info)
+	}
+	s.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	names := make([]string, 0, len(list))
+	for _, info := range list {
+		names = append(names, info.Name)
+	}
+	last, err := s.lastRuns(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if run, ok := last[list[i].Name]; ok {
+			list[i].LastRun = &run
+		}
+	}
+	return list, nil
+}
+
+// HasTask reports whether a task is registered under name
+func (s *Scheduler) HasTask(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.tasks[name]
+	return ok
+}
+
+// jitter returns a random delay up to max
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
@@ -0,0 +1 @@
+alter table articles add constraint articles_pkey primary key (id);
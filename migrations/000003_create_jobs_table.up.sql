@@ -0,0 +1,14 @@
+create table if not exists jobs (
+      id bigserial primary key,
+      kind varchar(64) not null,
+      status varchar(16) not null default 'queued',
+      params jsonb not null default '{}',
+      input bytea null,
+      progress jsonb not null default '{}',
+      error text not null default '',
+      created_at timestamp not null default now(),
+      updated_at timestamp null,
+      started_at timestamp null,
+      finished_at timestamp null
+);
+create index if not exists jobs_unfinished_idx on jobs (kind, id) where status in ('queued', 'running');
@@ -0,0 +1,9 @@
+drop index if exists jobs_status_idx;
+drop index if exists jobs_lease_idx;
+drop index if exists jobs_claim_idx;
+create index if not exists jobs_unfinished_idx on jobs (kind, id) where status in ('queued', 'running');
+alter table jobs drop column if exists locked_until;
+alter table jobs drop column if exists locked_by;
+alter table jobs drop column if exists run_at;
+alter table jobs drop column if exists max_attempts;
+alter table jobs drop column if exists attempts;
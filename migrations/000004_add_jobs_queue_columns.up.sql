@@ -0,0 +1,9 @@
+alter table jobs add column if not exists attempts int not null default 0;
+alter table jobs add column if not exists max_attempts int not null default 5;
+alter table jobs add column if not exists run_at timestamp not null default now();
+alter table jobs add column if not exists locked_by varchar(255) not null default '';
+alter table jobs add column if not exists locked_until timestamp null;
+drop index if exists jobs_unfinished_idx;
+create index if not exists jobs_claim_idx on jobs (kind, run_at, id) where status = 'queued';
+create index if not exists jobs_lease_idx on jobs (kind, locked_until) where status = 'running';
+create index if not exists jobs_status_idx on jobs (status, id);
@@ -0,0 +1 @@
+drop table if exists schedule_runs;
@@ -0,0 +1,14 @@
+create table if not exists schedule_runs (
+      id bigserial primary key,
+      task varchar(64) not null,
+      trigger varchar(16) not null,
+      status varchar(16) not null default 'running',
+      replica varchar(255) not null default '',
+      scheduled_at timestamptz not null,
+      started_at timestamptz not null default now(),
+      finished_at timestamptz null,
+      result jsonb null,
+      error text not null default ''
+);
+create unique index if not exists schedule_runs_slot_idx on schedule_runs (task, scheduled_at) where trigger = 'schedule';
+create index if not exists schedule_runs_task_idx on schedule_runs (task, id);
@@ -0,0 +1,7 @@
+alter table jobs
+      alter column locked_until type timestamp,
+      alter column run_at type timestamp,
+      alter column finished_at type timestamp,
+      alter column started_at type timestamp,
+      alter column updated_at type timestamp,
+      alter column created_at type timestamp;
@@ -0,0 +1,7 @@
+alter table jobs
+      alter column created_at type timestamptz,
+      alter column updated_at type timestamptz,
+      alter column started_at type timestamptz,
+      alter column finished_at type timestamptz,
+      alter column run_at type timestamptz,
+      alter column locked_until type timestamptz;
@@ -0,0 +1,9 @@
+package migrations
+
+import "embed"
+
+// FS holds every versioned migration, files are named
+// <version>_<name>.up.sql and <version>_<name>.down.sql
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,216 @@
+package article
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go-bunrouter-gorm-example/infrastructure/breaker"
+	"go-bunrouter-gorm-example/infrastructure/config"
+	logger "go-bunrouter-gorm-example/infrastructure/log"
+	"go-bunrouter-gorm-example/infrastructure/validator"
+	"go-bunrouter-gorm-example/module/primitive"
+	"go-bunrouter-gorm-example/utils"
+
+	"gorm.io/gorm"
+)
+
+// ErrBatchInvalid rejects a transactional batch holding an invalid item
+var ErrBatchInvalid = errors.New("batch has invalid items")
+
+// BatchArticle applies a bulk write. The creates go first in multi-row
+// inserts, then the updates and deletes in request order. The list caches
+// are invalidated once for the whole batch.
+func (s Service) BatchArticle(ctx context.Context, req primitive.ArticleBatchReq) (primitive.ArticleBatchResp, error) {
+	logCtx := fmt.Sprintf("service.BatchArticle")
+
+	mode := req.Mode
+	if mode == "" {
+		mode = primitive.BatchModeTransactional
+	}
+	resp := primitive.ArticleBatchResp{
+		Mode:  mode,
+		Items: make([]primitive.ArticleBatchItemResp, len(req.Items)),
+	}
+
+	invalid := 0
+	for i, item := range req.Items {
+		resp.Items[i] = primitive.ArticleBatchItemResp{Index: i, Op: item.Op, ID: item.ID}
+		if errValidate := validator.ValidateStructResponseSliceString(item); errValidate != nil {
+			resp.Items[i].Status = primitive.BatchStatusInvalid
+			resp.Items[i].Errors = errValidate
+			invalid++
+		}
+	}
+
+	var err error
+	switch {
+	case mode == primitive.BatchModeTransactional && invalid > 0:
+		err = ErrBatchInvalid
+	case mode == primitive.BatchModeTransactional:
+		err = s.repository.Transaction(ctx, func(repository RepositoryInterface) error {
+			return s.applyBatch(ctx, repository, req.Items, resp.Items, true)
+		})
+	default:
+		_ = s.applyBatch(ctx, s.repository, req.Items, resp.Items, false)
+	}
+
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.applyBatch")
+		//a rolled back item reports nothing of what it did
+		for i := range resp.Items {
+			switch resp.Items[i].Status {
+			case primitive.BatchStatusInvalid, primitive.BatchStatusNotFound, primitive.BatchStatusFailed:
+			default:
+				resp.Items[i].Status = primitive.BatchStatusNotApplied
+				resp.Items[i].Article = nil
+				if resp.Items[i].Op == primitive.BatchOpCreate {
+					resp.Items[i].ID = 0
+				}
+			}
+		}
+	} else {
+		s.invalidateBatch(ctx, logCtx, resp.Items)
+	}
+
+	for _, item := range resp.Items {
+		switch item.Status {
+		case primitive.BatchStatusCreated, primitive.BatchStatusUpdated, primitive.BatchStatusDeleted:
+			resp.Succeeded++
+		default:
+			resp.Failed++
+		}
+	}
+	return resp, err
+}
+
+// applyBatch writes every item not already marked invalid and records its
+// outcome in results. An atomic batch stops at the first failure and returns
+// it, otherwise every item is tried.
+func (s Service) applyBatch(ctx context.Context, repository RepositoryInterface, items []primitive.ArticleBatchItem, results []primitive.ArticleBatchItemResp, atomic bool) error {
+	logCtx := fmt.Sprintf("service.applyBatch")
+
+	creates := make([]int, 0, len(items))
+	payload := make([]primitive.Article, 0, len(items))
+	for i, item := range items {
+		if results[i].Status == "" && item.Op == primitive.BatchOpCreate {
+			creates = append(creates, i)
+			payload = append(payload, toArticle(*item.Article))
+		}
+	}
+
+	if len(payload) > 0 {
+		created, err := repository.CreateArticles(ctx, payload, config.Conf.Articles.BatchSize)
+		switch {
+		case err == nil:
+			for n, i := range creates {
+				markBatchItem(&results[i], primitive.BatchStatusCreated, created[n])
+			}
+		case atomic:
+			logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "repository.CreateArticles")
+			for _, i := range creates {
+				failBatchItem(&results[i], err)
+			}
+			return err
+		default:
+			//the multi-row insert is all or nothing, find the failing rows
+			//one insert at a time
+			logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "repository.CreateArticles")
+			for n, i := range creates {
+				data, errCreate := repository.CreateArticle(ctx, payload[n])
+				if errCreate != nil {
+					logger.Error(ctx, utils.ErrorLogFormat, errCreate.Error(), logCtx, "repository.CreateArticle")
+					failBatchItem(&results[i], errCreate)
+					continue
+				}
+				markBatchItem(&results[i], primitive.BatchStatusCreated, data)
+			}
+		}
+	}
+
+	for i, item := range items {
+		if results[i].Status != "" {
+			continue
+		}
+
+		var err error
+		var site string
+		switch item.Op {
+		case primitive.BatchOpUpdate:
+			site = "repository.UpdateArticle"
+			var data primitive.Article
+			data, err = repository.UpdateArticle(ctx, item.ID, toArticle(*item.Article))
+			if err == nil {
+				markBatchItem(&results[i], primitive.BatchStatusUpdated, data)
+			}
+		case primitive.BatchOpDelete:
+			site = "repository.DeleteArticle"
+			err = repository.DeleteArticle(ctx, item.ID)
+			if err == nil {
+				results[i].Status = primitive.BatchStatusDeleted
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, site)
+			}
+			failBatchItem(&results[i], err)
+			if atomic {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// invalidateBatch bumps the list generation once and drops the cached
+// entries of the articles the batch touched, created ones included since a
+// miss of their id may be cached
+func (s Service) invalidateBatch(ctx context.Context, logCtx string, results []primitive.ArticleBatchItemResp) {
+	touched := false
+	for _, item := range results {
+		switch item.Status {
+		case primitive.BatchStatusCreated, primitive.BatchStatusUpdated, primitive.BatchStatusDeleted:
+			touched = true
+			if !s.cacheEnabled() {
+				continue
+			}
+			if err := s.redis.DeleteKey(fmt.Sprintf(redisFinaleKeyArticle, item.ID)); err != nil {
+				logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.redis.DeleteKey")
+			}
+		}
+	}
+	if touched {
+		s.invalidateList(ctx, logCtx)
+	}
+}
+
+func toArticle(payload primitive.ArticleReq) primitive.Article {
+	return primitive.Article{
+		Author: payload.Author,
+		Title:  payload.Title,
+		Body:   payload.Body,
+	}
+}
+
+func markBatchItem(result *primitive.ArticleBatchItemResp, status string, data primitive.Article) {
+	article := toArticleResp(data)
+	result.Status = status
+	result.ID = data.ID
+	result.Article = &article
+}
+
+// failBatchItem records a failed write without leaking the database error
+func failBatchItem(result *primitive.ArticleBatchItemResp, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		result.Status = primitive.BatchStatusNotFound
+		result.Errors = []string{primitive.RecordArticleNotFound}
+	case errors.Is(err, breaker.ErrOpen):
+		result.Status = primitive.BatchStatusFailed
+		result.Errors = []string{primitive.DependencyUnavailable}
+	default:
+		result.Status = primitive.BatchStatusFailed
+		result.Errors = []string{primitive.SomethingWentWrong}
+	}
+}
@@ -0,0 +1,143 @@
+package article
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/breaker"
+	"go-bunrouter-gorm-example/module/primitive"
+
+	"gorm.io/gorm"
+)
+
+// BreakerRepository guards every database call of a RepositoryInterface with
+// a circuit breaker, while it is open the calls fail with breaker.ErrOpen
+type BreakerRepository struct {
+	repository RepositoryInterface
+	breaker    *breaker.Breaker
+}
+
+func NewBreakerRepository(repository RepositoryInterface, b *breaker.Breaker) RepositoryInterface {
+	return &BreakerRepository{
+		repository: repository,
+		breaker:    b,
+	}
+}
+
+// IsDatabaseFailure tells the errors that mean postgres itself is unhealthy,
+// a missing row or a cancelled request is not one of them
+func IsDatabaseFailure(err error) bool {
+	return err != nil &&
+		!errors.Is(err, gorm.ErrRecordNotFound) &&
+		!errors.Is(err, context.Canceled)
+}
+
+func (r *BreakerRepository) CreateArticle(ctx context.Context, payload primitive.Article) (data primitive.Article, err error) {
+	err = r.breaker.Execute(func() error {
+		data, err = r.repository.CreateArticle(ctx, payload)
+		return err
+	})
+	return data, err
+}
+
+func (r *BreakerRepository) CreateArticles(ctx context.Context, payload []primitive.Article, batchSize int) (data []primitive.Article, err error) {
+	err = r.breaker.Execute(func() error {
+		data, err = r.repository.CreateArticles(ctx, payload, batchSize)
+		return err
+	})
+	return data, err
+}
+
+func (r *BreakerRepository) CountArticle(ctx context.Context, param primitive.ParameterFindArticle) (count int64, err error) {
+	err = r.breaker.Execute(func() error {
+		count, err = r.repository.CountArticle(ctx, param)
+		return err
+	})
+	return count, err
+}
+
+func (r *BreakerRepository) FindListArticle(ctx context.Context, param primitive.ParameterFindArticle) (data []primitive.Article, err error) {
+	err = r.breaker.Execute(func() error {
+		data, err = r.repository.FindListArticle(ctx, param)
+		return err
+	})
+	return data, err
+}
+
+func (r *BreakerRepository) FindArticleByID(ctx context.Context, articleID int64) (data primitive.Article, err error) {
+	err = r.breaker.Execute(func() error {
+		data, err = r.repository.FindArticleByID(ctx, articleID)
+		return err
+	})
+	return data, err
+}
+
+// StreamArticles does not count a failing fn against the breaker, the
+// consumer, e.g. a client that went away, is not the database
+func (r *BreakerRepository) StreamArticles(ctx context.Context, param primitive.ParameterFindArticle, columns []string, statementTimeout time.Duration, fn func(data primitive.Article) error) error {
+	var errConsumer error
+	err := r.breaker.Execute(func() error {
+		err := r.repository.StreamArticles(ctx, param, columns, statementTimeout, func(data primitive.Article) error {
+			if err := fn(data); err != nil {
+				errConsumer = err
+				return err
+			}
+			return nil
+		})
+		if errConsumer != nil {
+			return nil
+		}
+		return err
+	})
+	if errConsumer != nil {
+		return errConsumer
+	}
+	return err
+}
+
+func (r *BreakerRepository) UpdateArticle(ctx context.Context, articleID int64, payload primitive.Article) (data primitive.Article, err error) {
+	err = r.breaker.Execute(func() error {
+		data, err = r.repository.UpdateArticle(ctx, articleID, payload)
+		return err
+	})
+	return data, err
+}
+
+func (r *BreakerRepository) DeleteArticle(ctx context.Context, articleID int64) error {
+	return r.breaker.Execute(func() error {
+		return r.repository.DeleteArticle(ctx, articleID)
+	})
+}
+
+// Transaction counts the whole transaction as one call, the repository
+// handed to fn is the unguarded one bound to the transaction
+func (r *BreakerRepository) Transaction(ctx context.Context, fn func(repository RepositoryInterface) error) error {
+	return r.breaker.Execute(func() error {
+		return r.repository.Transaction(ctx, fn)
+	})
+}
+
+func (r *BreakerRepository) SetParamQueryToOrderByQuery(orderBy string) string {
+	return r.repository.SetParamQueryToOrderByQuery(orderBy)
+}
+
+func (r *BreakerRepository) SaveImportProgress(ctx context.Context, jobID int64, progress string) error {
+	return r.breaker.Execute(func() error {
+		return r.repository.SaveImportProgress(ctx, jobID, progress)
+	})
+}
+
+func (r *BreakerRepository) PurgeDeletedArticles(ctx context.Context, deletedBefore time.Time, limit int) (count int64, err error) {
+	err = r.breaker.Execute(func() error {
+		count, err = r.repository.PurgeDeletedArticles(ctx, deletedBefore, limit)
+		return err
+	})
+	return count, err
+}
+
+func (r *BreakerRepository) AnalyzeArticles(ctx context.Context) error {
+	return r.breaker.Execute(func() error {
+		return r.repository.AnalyzeArticles(ctx)
+	})
+}
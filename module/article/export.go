@@ -0,0 +1,184 @@
+package article
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-bunrouter-gorm-example/module/primitive"
+)
+
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+
+	// how many rows are written between two flushes to the client
+	exportFlushRows = 100
+)
+
+// exportColumn is a field an export can carry, named like its json key in
+// primitive.ArticleResp
+type exportColumn struct {
+	name   string
+	column string
+	value  func(data primitive.ArticleResp) interface{}
+}
+
+// exportColumns lists the exportable fields in their default order
+var exportColumns = []exportColumn{
+	{name: "id", column: "id", value: func(data primitive.ArticleResp) interface{} { return data.ID }},
+	{name: "author", column: "author", value: func(data primitive.ArticleResp) interface{} { return data.Author }},
+	{name: "title", column: "title", value: func(data primitive.ArticleResp) interface{} { return data.Title }},
+	{name: "body", column: "body", value: func(data primitive.ArticleResp) interface{} { return data.Body }},
+	{name: "createdAt", column: "created_at", value: func(data primitive.ArticleResp) interface{} { return data.CreatedAt }},
+	{name: "updatedAt", column: "updated_at", value: func(data primitive.ArticleResp) interface{} { return data.UpdatedAt }},
+}
+
+// parseExportColumns resolves a comma separated list of field names, an
+// empty list selects every field
+func parseExportColumns(list string) ([]exportColumn, error) {
+	if strings.TrimSpace(list) == "" {
+		return exportColumns, nil
+	}
+
+	selected := make([]exportColumn, 0, len(exportColumns))
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if seen[name] {
+			continue
+		}
+		found := false
+		for _, column := range exportColumns {
+			if column.name == name {
+				selected = append(selected, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown export column %q", name)
+		}
+		seen[name] = true
+	}
+	return selected, nil
+}
+
+// exportContentType returns the media type of an export format
+func exportContentType(format string) string {
+	if format == exportFormatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// exportEncoder writes an export one article at a time
+type exportEncoder interface {
+	WriteHeader() error
+	Write(data primitive.ArticleResp) error
+	// Flush pushes the buffered rows to the underlying writer
+	Flush() error
+}
+
+func newExportEncoder(format string, w io.Writer, columns []exportColumn) exportEncoder {
+	if format == exportFormatNDJSON {
+		return &ndjsonEncoder{w: bufio.NewWriter(w), columns: columns}
+	}
+	return &csvEncoder{w: csv.NewWriter(w), columns: columns}
+}
+
+type csvEncoder struct {
+	w       *csv.Writer
+	columns []exportColumn
+	record  []string
+}
+
+func (e *csvEncoder) WriteHeader() error {
+	header := make([]string, len(e.columns))
+	for i, column := range e.columns {
+		header[i] = column.name
+	}
+	return e.w.Write(header)
+}
+
+func (e *csvEncoder) Write(data primitive.ArticleResp) error {
+	if e.record == nil {
+		e.record = make([]string, len(e.columns))
+	}
+	for i, column := range e.columns {
+		switch value := column.value(data).(type) {
+		case int64:
+			e.record[i] = strconv.FormatInt(value, 10)
+		case time.Time:
+			e.record[i] = value.Format(time.RFC3339Nano)
+		default:
+			e.record[i] = escapeFormula(fmt.Sprint(value))
+		}
+	}
+	return e.w.Write(e.record)
+}
+
+// formulaTriggers are the leading characters that make a spreadsheet read a
+// cell as a formula. A leading quote is escaped too, so unescapeFormula can
+// tell the quotes it has to drop from the ones that belong to the value.
+const formulaTriggers = "=+-@\t\r'"
+
+// escapeFormula prefixes a cell a spreadsheet would read as a formula with a
+// single quote, so it is shown as text instead
+func escapeFormula(cell string) string {
+	if cell != "" && strings.IndexByte(formulaTriggers, cell[0]) >= 0 {
+		return "'" + cell
+	}
+	return cell
+}
+
+// unescapeFormula drops the quote escapeFormula added, so an export is
+// imported back unchanged
+func unescapeFormula(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.IndexByte(formulaTriggers, cell[1]) >= 0 {
+		return cell[1:]
+	}
+	return cell
+}
+
+func (e *csvEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonEncoder writes one json object per line with the fields in column
+// order
+type ndjsonEncoder struct {
+	w       *bufio.Writer
+	columns []exportColumn
+}
+
+func (e *ndjsonEncoder) WriteHeader() error {
+	return nil
+}
+
+func (e *ndjsonEncoder) Write(data primitive.ArticleResp) error {
+	e.w.WriteByte('{')
+	for i, column := range e.columns {
+		if i > 0 {
+			e.w.WriteByte(',')
+		}
+		value, err := json.Marshal(column.value(data))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.w, "%q:", column.name)
+		e.w.Write(value)
+	}
+	_, err := e.w.WriteString("}\n")
+	return err
+}
+
+func (e *ndjsonEncoder) Flush() error {
+	return e.w.Flush()
+}
@@ -0,0 +1,31 @@
+package article
+
+import "testing"
+
+func TestEscapeFormula(t *testing.T) {
+	tests := []struct {
+		cell string
+		want string
+	}{
+		{cell: "", want: ""},
+		{cell: "plain", want: "plain"},
+		{cell: "=1+1", want: "'=1+1"},
+		{cell: "+1", want: "'+1"},
+		{cell: "-1", want: "'-1"},
+		{cell: "@SUM(A1)", want: "'@SUM(A1)"},
+		{cell: "\t=1", want: "'\t=1"},
+		{cell: "\r=1", want: "'\r=1"},
+		{cell: "'=1", want: "''=1"},
+		{cell: "'quoted", want: "''quoted"},
+		{cell: "a=1", want: "a=1"},
+	}
+	for _, tt := range tests {
+		got := escapeFormula(tt.cell)
+		if got != tt.want {
+			t.Errorf("escapeFormula(%q) = %q, want %q", tt.cell, got, tt.want)
+		}
+		if back := unescapeFormula(got); back != tt.cell {
+			t.Errorf("unescapeFormula(%q) = %q, want %q back", got, back, tt.cell)
+		}
+	}
+}
@@ -1,14 +1,21 @@
 package article
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"gorm.io/gorm"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
+	"go-bunrouter-gorm-example/infrastructure/breaker"
+	"go-bunrouter-gorm-example/infrastructure/config"
 	"go-bunrouter-gorm-example/infrastructure/httplib"
 	logger "go-bunrouter-gorm-example/infrastructure/log"
 	"go-bunrouter-gorm-example/infrastructure/validator"
@@ -30,17 +37,26 @@ func NewHttp(serviceHealth InterfaceService) InterfaceHttp {
 
 type InterfaceHttp interface {
 	GroupArticle(group *bunrouter.Group)
+	GroupArticleMethod(group *bunrouter.Group)
 }
 
 func (h *Http) GroupArticle(g *bunrouter.Group) {
 	g.GET("", h.GetListArticle)
+	g.GET("/export", h.ExportArticle)
 	g.GET("/:id", h.DetailArticle)
 	g.POST("", h.CreateArticle)
+	g.POST("/import", h.ImportArticle)
+}
+
+// GroupArticleMethod registers the custom methods of the collection, they
+// are suffixed to its path so they are registered on the parent group.
+func (h *Http) GroupArticleMethod(g *bunrouter.Group) {
+	g.POST("/articles:batch", h.BatchArticle)
 }
 
 func (h *Http) GetListArticle(w http.ResponseWriter, c bunrouter.Request) error {
 	logCtx := fmt.Sprintf("handler.GetListArticle")
-	ctx := context.Background()
+	ctx := c.Context()
 
 	if h.serviceArticle == nil {
 		err := errors.New("dependency service article to handler article on method GetListArticle is nil")
@@ -54,32 +70,18 @@ func (h *Http) GetListArticle(w http.ResponseWriter, c bunrouter.Request) error
 		return httplib.SetErrorResponse(w, http.StatusBadRequest, err.Error())
 	}
 
-	query := c.Request.URL.Query().Get("query")
-	if query != "" {
-		if !utils.IsValidSanitizeSQL(query) {
-			err = errors.New(primitive.QueryIsSuspicious)
-			logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "utils.IsValidSanitizeSQL")
-			return httplib.SetErrorResponse(w, http.StatusBadRequest, primitive.QueryIsSuspicious)
-		}
-	}
-
-	author := c.Request.URL.Query().Get("author")
-	if author != "" {
-		if !utils.IsValidSanitizeSQL(author) {
-			err = errors.New(primitive.QueryIsSuspicious)
-			logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "utils.IsValidSanitizeSQL")
-			return httplib.SetErrorResponse(w, http.StatusBadRequest, primitive.QueryIsSuspicious)
-		}
-	}
-
-	param := primitive.ParameterArticleHandler{
-		Query:  query,
-		Author: author,
+	param, err := filterFromQuery(c)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "utils.IsValidSanitizeSQL")
+		return httplib.SetErrorResponse(w, http.StatusBadRequest, primitive.QueryIsSuspicious)
 	}
 
 	data, count, err := h.serviceArticle.GetListArticle(ctx, param, paginationQuery)
 	if err != nil {
 		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceArticle.GetListArticle")
+		if errors.Is(err, breaker.ErrOpen) {
+			return httplib.SetErrorResponse(w, http.StatusServiceUnavailable, primitive.DependencyUnavailable)
+		}
 		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
 	}
 
@@ -92,9 +94,125 @@ func (h *Http) GetListArticle(w http.ResponseWriter, c bunrouter.Request) error
 
 }
 
+// filterFromQuery reads the query and author filters shared by the list and
+// the export
+func filterFromQuery(c bunrouter.Request) (primitive.ParameterArticleHandler, error) {
+	query := c.Request.URL.Query().Get("query")
+	if query != "" && !utils.IsValidSanitizeSQL(query) {
+		return primitive.ParameterArticleHandler{}, errors.New(primitive.QueryIsSuspicious)
+	}
+
+	author := c.Request.URL.Query().Get("author")
+	if author != "" && !utils.IsValidSanitizeSQL(author) {
+		return primitive.ParameterArticleHandler{}, errors.New(primitive.QueryIsSuspicious)
+	}
+
+	return primitive.ParameterArticleHandler{
+		Query:  query,
+		Author: author,
+	}, nil
+}
+
+// ExportArticle streams the articles matching the list filters as csv or
+// ndjson, flushing every exportFlushRows rows
+func (h *Http) ExportArticle(w http.ResponseWriter, c bunrouter.Request) error {
+	logCtx := fmt.Sprintf("handler.ExportArticle")
+	ctx := c.Context()
+
+	if h.serviceArticle == nil {
+		err := errors.New("dependency service article to handler article on method ExportArticle is nil")
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceHealth")
+		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
+	}
+
+	format := c.Request.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatCSV
+	}
+	if format != exportFormatCSV && format != exportFormatNDJSON {
+		err := fmt.Errorf("unknown export format %q", format)
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "c.Request.URL.Query")
+		return httplib.SetErrorResponse(w, http.StatusBadRequest, primitive.ExportFormatInvalid)
+	}
+
+	columns, err := parseExportColumns(c.Request.URL.Query().Get("columns"))
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "parseExportColumns")
+		return httplib.SetErrorResponse(w, http.StatusBadRequest, err.Error())
+	}
+	dbColumns := make([]string, len(columns))
+	for i, column := range columns {
+		dbColumns[i] = column.column
+	}
+
+	param, err := filterFromQuery(c)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "utils.IsValidSanitizeSQL")
+		return httplib.SetErrorResponse(w, http.StatusBadRequest, primitive.QueryIsSuspicious)
+	}
+
+	sort := &httplib.Query{}
+	sort.SetOrderBy(c.Request.URL.Query().Get("orderBy"))
+	sort.SetSortOrder(c.Request.URL.Query().Get("sortOrder"))
+
+	//the status is only sent with the first row, so a query failing up front
+	//still gets a proper error response
+	encoder := newExportEncoder(format, w, columns)
+	controller := http.NewResponseController(w)
+	started := false
+	start := func() error {
+		started = true
+		filename := fmt.Sprintf("articles-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+		w.Header().Set("Content-Type", exportContentType(format))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		return encoder.WriteHeader()
+	}
+
+	rows := 0
+	err = h.serviceArticle.ExportArticle(ctx, param, sort, dbColumns, func(data primitive.ArticleResp) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := encoder.Write(data); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushRows == 0 {
+			if err := encoder.Flush(); err != nil {
+				return err
+			}
+			return controller.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceArticle.ExportArticle")
+		if started {
+			//the client already got a 200, cut the stream so it can not
+			//mistake a partial export for a complete one
+			panic(http.ErrAbortHandler)
+		}
+		if errors.Is(err, breaker.ErrOpen) {
+			return httplib.SetErrorResponse(w, http.StatusServiceUnavailable, primitive.DependencyUnavailable)
+		}
+		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
+	}
+
+	if !started {
+		if err = start(); err != nil {
+			return err
+		}
+	}
+	return encoder.Flush()
+}
+
 func (h *Http) CreateArticle(w http.ResponseWriter, c bunrouter.Request) error {
 	logCtx := fmt.Sprintf("handler.CreateArticle")
-	ctx := context.Background()
+	ctx := c.Context()
 
 	if h.serviceArticle == nil {
 		err := errors.New("dependency service article to handler article on method CreateArticle is nil")
@@ -117,7 +235,10 @@ func (h *Http) CreateArticle(w http.ResponseWriter, c bunrouter.Request) error {
 
 	data, err := h.serviceArticle.RecordArticle(ctx, requestBody)
 	if err != nil {
-		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceArticle.GetListArticle")
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceArticle.RecordArticle")
+		if errors.Is(err, breaker.ErrOpen) {
+			return httplib.SetErrorResponse(w, http.StatusServiceUnavailable, primitive.DependencyUnavailable)
+		}
 		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
 	}
 
@@ -125,9 +246,169 @@ func (h *Http) CreateArticle(w http.ResponseWriter, c bunrouter.Request) error {
 
 }
 
+func (h *Http) BatchArticle(w http.ResponseWriter, c bunrouter.Request) error {
+	logCtx := fmt.Sprintf("handler.BatchArticle")
+	ctx := c.Context()
+
+	if h.serviceArticle == nil {
+		err := errors.New("dependency service article to handler article on method BatchArticle is nil")
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceHealth")
+		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
+	}
+
+	var requestBody primitive.ArticleBatchReq
+	if err := json.NewDecoder(c.Body).Decode(&requestBody); err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "json.NewDecoder")
+		return httplib.SetErrorResponse(w, http.StatusBadRequest, primitive.SomethingWrongWithTheBodyRequest)
+	}
+
+	//the items are validated one by one by the service, so a best effort
+	//batch can report them apart
+	errValidateStruct := validator.ValidateStructResponseSliceString(requestBody)
+	if errValidateStruct != nil {
+		logger.Error(ctx, logCtx, "validator.ValidateStructResponseSliceString got err : %v", errValidateStruct)
+		return httplib.SetCustomResponse(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil, errValidateStruct)
+	}
+
+	if len(requestBody.Items) > config.Conf.Articles.BatchMaxItems {
+		err := fmt.Errorf("batch of %d items is over the limit of %d", len(requestBody.Items), config.Conf.Articles.BatchMaxItems)
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "config.Conf.Articles.BatchMaxItems")
+		return httplib.SetErrorResponse(w, http.StatusRequestEntityTooLarge, primitive.BatchArticleTooLarge)
+	}
+
+	data, err := h.serviceArticle.BatchArticle(ctx, requestBody)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceArticle.BatchArticle")
+		switch {
+		case errors.Is(err, ErrBatchInvalid):
+			return httplib.SetCustomResponse(w, http.StatusBadRequest, primitive.BatchArticleInvalid, data, nil)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return httplib.SetCustomResponse(w, http.StatusNotFound, primitive.BatchArticleNotApplied, data, nil)
+		case errors.Is(err, breaker.ErrOpen):
+			return httplib.SetErrorResponse(w, http.StatusServiceUnavailable, primitive.DependencyUnavailable)
+		default:
+			return httplib.SetCustomResponse(w, http.StatusInternalServerError, primitive.BatchArticleNotApplied, data, nil)
+		}
+	}
+
+	return httplib.SetSuccessResponse(w, http.StatusOK, primitive.SuccessBatchArticle, data)
+
+}
+
+// ImportMultipartOverhead is the room left in an import body for the
+// multipart boundaries and the other fields
+const ImportMultipartOverhead = 64 << 10
+
+// importFormat picks the format of an upload from the format field, else
+// from the file extension or its content type, "" when none is known
+func importFormat(field string, header *multipart.FileHeader) string {
+	switch strings.ToLower(field) {
+	case primitive.ImportFormatCSV:
+		return primitive.ImportFormatCSV
+	case primitive.ImportFormatNDJSON:
+		return primitive.ImportFormatNDJSON
+	case "":
+	default:
+		return ""
+	}
+
+	switch strings.ToLower(filepath.Ext(header.Filename)) {
+	case ".csv":
+		return primitive.ImportFormatCSV
+	case ".ndjson", ".jsonl":
+		return primitive.ImportFormatNDJSON
+	}
+	mediaType, _, _ := mime.ParseMediaType(header.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return primitive.ImportFormatCSV
+	case "application/x-ndjson", "application/jsonl":
+		return primitive.ImportFormatNDJSON
+	}
+	return ""
+}
+
+// ImportArticle takes a csv or ndjson file from the file field of a
+// multipart body and answers 202 with the job importing it
+func (h *Http) ImportArticle(w http.ResponseWriter, c bunrouter.Request) error {
+	logCtx := fmt.Sprintf("handler.ImportArticle")
+	ctx := c.Context()
+
+	if h.serviceArticle == nil {
+		err := errors.New("dependency service article to handler article on method ImportArticle is nil")
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceHealth")
+		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
+	}
+
+	//the multipart overhead is small next to the file
+	maxBytes := config.Conf.Articles.ImportMaxBytes
+	c.Request.Body = http.MaxBytesReader(w, c.Request.Body, maxBytes+ImportMultipartOverhead)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "c.Request.FormFile")
+		var errTooLarge *http.MaxBytesError
+		if errors.As(err, &errTooLarge) {
+			return httplib.SetErrorResponse(w, http.StatusRequestEntityTooLarge, primitive.ImportFileTooLarge)
+		}
+		return httplib.SetErrorResponse(w, http.StatusBadRequest, primitive.ImportFileMissing)
+	}
+	defer file.Close()
+	defer c.Request.MultipartForm.RemoveAll()
+
+	if header.Size > maxBytes {
+		err = fmt.Errorf("file of %d bytes is over the limit of %d", header.Size, maxBytes)
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "config.Conf.Articles.ImportMaxBytes")
+		return httplib.SetErrorResponse(w, http.StatusRequestEntityTooLarge, primitive.ImportFileTooLarge)
+	}
+
+	format := importFormat(c.Request.FormValue("format"), header)
+	if format == "" {
+		err = fmt.Errorf("no import format for file %q", header.Filename)
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "importFormat")
+		return httplib.SetErrorResponse(w, http.StatusBadRequest, primitive.ImportFormatInvalid)
+	}
+
+	dryRun := false
+	if value := c.Request.FormValue("dryRun"); value != "" {
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "strconv.ParseBool")
+			return httplib.SetErrorResponse(w, http.StatusBadRequest, primitive.SomethingWrongWithTheBodyRequest)
+		}
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "io.ReadAll")
+		return httplib.SetErrorResponse(w, http.StatusBadRequest, primitive.SomethingWrongWithTheBodyRequest)
+	}
+
+	resp, err := h.serviceArticle.ImportArticle(ctx, primitive.ArticleImportReq{
+		Filename: header.Filename,
+		Format:   format,
+		DryRun:   dryRun,
+		Data:     data,
+	})
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceArticle.ImportArticle")
+		switch {
+		case errors.Is(err, ErrImportInvalid):
+			return httplib.SetCustomResponse(w, http.StatusBadRequest, primitive.ImportFileInvalid, nil, []string{err.Error()})
+		case errors.Is(err, breaker.ErrOpen):
+			return httplib.SetErrorResponse(w, http.StatusServiceUnavailable, primitive.DependencyUnavailable)
+		default:
+			return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
+		}
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/jobs/%d", resp.ID))
+	return httplib.SetSuccessResponse(w, http.StatusAccepted, primitive.SuccessImportArticle, resp)
+
+}
+
 func (h *Http) DetailArticle(w http.ResponseWriter, c bunrouter.Request) error {
 	logCtx := fmt.Sprintf("handler.DetailArticle")
-	ctx := context.Background()
+	ctx := c.Context()
 
 	if h.serviceArticle == nil {
 		err := errors.New("dependency service article to handler article on method DetailArticle is nil")
@@ -156,6 +437,9 @@ func (h *Http) DetailArticle(w http.ResponseWriter, c bunrouter.Request) error {
 			return httplib.SetErrorResponse(w, http.StatusNotFound, primitive.RecordArticleNotFound)
 		}
 		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceArticle.GetDetailArticle")
+		if errors.Is(err, breaker.ErrOpen) {
+			return httplib.SetErrorResponse(w, http.StatusServiceUnavailable, primitive.DependencyUnavailable)
+		}
 		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
 	}
 
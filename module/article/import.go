@@ -0,0 +1,304 @@
+package article
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"go-bunrouter-gorm-example/infrastructure/config"
+	"go-bunrouter-gorm-example/infrastructure/jobs"
+	logger "go-bunrouter-gorm-example/infrastructure/log"
+	"go-bunrouter-gorm-example/infrastructure/validator"
+	"go-bunrouter-gorm-example/module/primitive"
+	"go-bunrouter-gorm-example/utils"
+
+	"gorm.io/gorm"
+)
+
+// ErrImportInvalid rejects an upload that can not be read as articles
+var ErrImportInvalid = errors.New("import file is invalid")
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// importColumns are the csv columns an import needs, the others are ignored
+// so an export can be imported back
+var importColumns = []string{"author", "title", "body"}
+
+// importRowError is a row that can not be decoded, the rows after it are
+// still read
+type importRowError struct {
+	reason string
+}
+
+func (e importRowError) Error() string {
+	return e.reason
+}
+
+// importReader reads the rows of an uploaded file one at a time
+type importReader interface {
+	// Next returns the next row, an importRowError for a row that can not
+	// be decoded, or io.EOF after the last row
+	Next() (primitive.ArticleReq, error)
+}
+
+func newImportReader(format string, data []byte) (importReader, error) {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	switch format {
+	case primitive.ImportFormatCSV:
+		return newCSVImportReader(data)
+	case primitive.ImportFormatNDJSON:
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		// a single line may be the whole file
+		scanner.Buffer(nil, len(data)+1)
+		return &ndjsonImportReader{scanner: scanner}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown format %q", ErrImportInvalid, format)
+}
+
+type csvImportReader struct {
+	r      *csv.Reader
+	index  map[string]int
+	fields int
+}
+
+// newCSVImportReader reads the header, it must name every importColumns
+func newCSVImportReader(data []byte) (importReader, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: the file is empty", ErrImportInvalid)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrImportInvalid, err)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := index[name]; !ok {
+			index[name] = i
+		}
+	}
+	for _, column := range importColumns {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("%w: the header has no %s column", ErrImportInvalid, column)
+		}
+	}
+	return &csvImportReader{r: r, index: index, fields: len(header)}, nil
+}
+
+func (r *csvImportReader) Next() (primitive.ArticleReq, error) {
+	record, err := r.r.Read()
+	if err == io.EOF {
+		return primitive.ArticleReq{}, io.EOF
+	}
+	var errParse *csv.ParseError
+	if errors.As(err, &errParse) {
+		return primitive.ArticleReq{}, importRowError{reason: errParse.Err.Error()}
+	}
+	if err != nil {
+		return primitive.ArticleReq{}, err
+	}
+	if len(record) != r.fields {
+		return primitive.ArticleReq{}, importRowError{reason: fmt.Sprintf("row has %d fields, the header has %d", len(record), r.fields)}
+	}
+	return primitive.ArticleReq{
+		Author: unescapeFormula(record[r.index["author"]]),
+		Title:  unescapeFormula(record[r.index["title"]]),
+		Body:   unescapeFormula(record[r.index["body"]]),
+	}, nil
+}
+
+// ndjsonImportReader reads one json object per line, blank lines are not
+// rows
+type ndjsonImportReader struct {
+	scanner *bufio.Scanner
+}
+
+func (r *ndjsonImportReader) Next() (primitive.ArticleReq, error) {
+	for r.scanner.Scan() {
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var data primitive.ArticleReq
+		if err := json.Unmarshal(line, &data); err != nil {
+			return primitive.ArticleReq{}, importRowError{reason: "invalid json: " + err.Error()}
+		}
+		return data, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return primitive.ArticleReq{}, err
+	}
+	return primitive.ArticleReq{}, io.EOF
+}
+
+// ImportArticle queues a job importing the upload, an upload that can not be
+// read is rejected up front
+func (s Service) ImportArticle(ctx context.Context, req primitive.ArticleImportReq) (primitive.JobResp, error) {
+	logCtx := fmt.Sprintf("service.ImportArticle")
+
+	if _, err := newImportReader(req.Format, req.Data); err != nil {
+		return primitive.JobResp{}, err
+	}
+
+	params := primitive.ArticleImportParams{
+		Filename: req.Filename,
+		Format:   req.Format,
+		DryRun:   req.DryRun,
+		Size:     len(req.Data),
+	}
+	data, err := s.queue.Enqueue(ctx, primitive.JobKindArticleImport, params, jobs.EnqueueOptions{
+		Input:    req.Data,
+		Progress: primitive.ArticleImportProgress{Errors: []primitive.ArticleImportRowError{}},
+	})
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.queue.Enqueue")
+		return primitive.JobResp{}, err
+	}
+	return toJobResp(data), nil
+}
+
+// ImportJob imports the rows of a job its previous attempts did not account
+// for. Every articles.batchSize rows, the valid ones are inserted and the
+// progress is saved in one transaction, so an interrupted job resumes after
+// the last committed row. The file is read once, its total is known when the
+// last row has been read. A file that can not be read fails the job without
+// retrying it.
+func (s Service) ImportJob(ctx context.Context, job *jobs.Job, params primitive.ArticleImportParams) error {
+	logCtx := fmt.Sprintf("service.ImportJob")
+
+	var progress primitive.ArticleImportProgress
+	if err := json.Unmarshal(job.Progress, &progress); err != nil {
+		return jobs.Permanent(fmt.Errorf("decode progress: %w", err))
+	}
+	reader, err := newImportReader(params.Format, job.Input)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	//skip the rows a previous attempt already accounted for
+	for row := 0; row < progress.Processed; row++ {
+		var errRow importRowError
+		_, err = reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !errors.As(err, &errRow) {
+			return jobs.Permanent(err)
+		}
+	}
+
+	batchSize := config.Conf.Articles.BatchSize
+	chunk := make([]primitive.Article, 0, batchSize)
+	for done := false; !done; {
+		chunk = chunk[:0]
+		rows := 0
+		for rows < batchSize {
+			data, errRow := reader.Next()
+			if errRow == io.EOF {
+				done = true
+				break
+			}
+			rows++
+			progress.Processed++
+
+			var errDecode importRowError
+			if errors.As(errRow, &errDecode) {
+				skipImportRow(&progress, []string{errDecode.reason})
+				continue
+			}
+			if errRow != nil {
+				return jobs.Permanent(errRow)
+			}
+			if errValidate := validator.ValidateStructResponseSliceString(data); errValidate != nil {
+				skipImportRow(&progress, errValidate)
+				continue
+			}
+			chunk = append(chunk, toArticle(data))
+		}
+		if done {
+			progress.Total = progress.Processed
+		}
+		if rows == 0 {
+			if err = s.repository.SaveImportProgress(ctx, job.ID, encodeImportProgress(progress)); err != nil {
+				return ignoreStoppedJob(err)
+			}
+			break
+		}
+
+		progress.Created += len(chunk)
+		err = s.repository.Transaction(ctx, func(repository RepositoryInterface) error {
+			if !params.DryRun && len(chunk) > 0 {
+				if _, err := repository.CreateArticles(ctx, chunk, batchSize); err != nil {
+					return err
+				}
+			}
+			return repository.SaveImportProgress(ctx, job.ID, encodeImportProgress(progress))
+		})
+		if err != nil {
+			return ignoreStoppedJob(err)
+		}
+		if !params.DryRun && len(chunk) > 0 {
+			s.invalidateList(ctx, logCtx)
+		}
+	}
+	return nil
+}
+
+// ignoreStoppedJob drops the error of a progress update on a job that is no
+// longer running, e.g. cancelled, there is nothing left to do for it
+func ignoreStoppedJob(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+// skipImportRow counts a rejected row, its errors are kept up to
+// articles.importMaxErrors rows
+func skipImportRow(progress *primitive.ArticleImportProgress, errs []string) {
+	progress.Skipped++
+	if len(progress.Errors) >= config.Conf.Articles.ImportMaxErrors {
+		progress.ErrorsTruncated = true
+		return
+	}
+	progress.Errors = append(progress.Errors, primitive.ArticleImportRowError{
+		Row:    progress.Processed,
+		Errors: errs,
+	})
+}
+
+func encodeImportProgress(progress primitive.ArticleImportProgress) string {
+	if progress.Errors == nil {
+		progress.Errors = []primitive.ArticleImportRowError{}
+	}
+	data, _ := json.Marshal(progress)
+	return string(data)
+}
+
+func toJobResp(data jobs.Job) primitive.JobResp {
+	return primitive.JobResp{
+		ID:          data.ID,
+		Kind:        data.Kind,
+		Status:      data.Status,
+		Params:      data.Params,
+		Progress:    data.Progress,
+		Error:       data.Error,
+		Attempts:    data.Attempts,
+		MaxAttempts: data.MaxAttempts,
+		RunAt:       data.RunAt,
+		LockedUntil: data.LockedUntil,
+		CreatedAt:   data.CreatedAt,
+		UpdatedAt:   data.UpdatedAt,
+		StartedAt:   data.StartedAt,
+		FinishedAt:  data.FinishedAt,
+	}
+}
@@ -0,0 +1,100 @@
+package article
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go-bunrouter-gorm-example/infrastructure/cache"
+	"go-bunrouter-gorm-example/infrastructure/config"
+	"go-bunrouter-gorm-example/infrastructure/httplib"
+	logger "go-bunrouter-gorm-example/infrastructure/log"
+	"go-bunrouter-gorm-example/module/primitive"
+	"go-bunrouter-gorm-example/utils"
+)
+
+// PurgeDeletedArticles removes the articles deleted more than
+// articles.purgeAfter ago, articles.batchSize rows at a time so it never
+// holds many row locks. A cancelled purge keeps the batches it removed.
+func (s Service) PurgeDeletedArticles(ctx context.Context) (primitive.ArticlePurgeResult, error) {
+	logCtx := fmt.Sprintf("service.PurgeDeletedArticles")
+
+	result := primitive.ArticlePurgeResult{
+		DeletedBefore: time.Now().Add(-config.Conf.Articles.PurgeAfter),
+	}
+	batchSize := config.Conf.Articles.BatchSize
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		purged, err := s.repository.PurgeDeletedArticles(ctx, result.DeletedBefore, batchSize)
+		if err != nil {
+			logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.repository.PurgeDeletedArticles")
+			return result, err
+		}
+		result.Purged += purged
+		if purged < int64(batchSize) {
+			return result, nil
+		}
+	}
+}
+
+// WarmListCache loads the first cache.warmPages pages of the default list,
+// as a request without query parameters reads them, into the list cache of
+// the current generation. It stops at the last page of articles.
+func (s Service) WarmListCache(ctx context.Context) (primitive.ArticleWarmResult, error) {
+	logCtx := fmt.Sprintf("service.WarmListCache")
+
+	result := primitive.ArticleWarmResult{}
+	if !s.cacheEnabled() {
+		return result, nil
+	}
+	generation, err := s.listGeneration(ctx)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.listGeneration")
+		return result, err
+	}
+	result.Generation = generation
+
+	for page := 1; page <= config.Conf.Cache.WarmPages; page++ {
+		pagination := &httplib.Query{}
+		if err := pagination.SetPage(strconv.Itoa(page)); err != nil {
+			return result, err
+		}
+		if err := pagination.SetSize(""); err != nil {
+			return result, err
+		}
+		pagination.SetSortOrder("")
+
+		paramQuery := s.listQuery(primitive.ParameterArticleHandler{}, pagination)
+		fingerprint := listFingerprint(paramQuery)
+		envelope, err := s.loadListArticle(ctx, logCtx, paramQuery, fingerprint)
+		if err != nil {
+			return result, err
+		}
+		cacheKey := fmt.Sprintf("%s:%s:%s", redisListFinaleKeyArticle, result.Generation, fingerprint)
+		if err = cache.Set(s.cache, s.articleListEntity(), cacheKey, envelope); err != nil {
+			logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "cache.Set")
+			return result, err
+		}
+		result.Pages++
+
+		if int64(paramQuery.Offset+paramQuery.PageSize) >= envelope.Total {
+			break
+		}
+	}
+	return result, nil
+}
+
+// AnalyzeArticles refreshes the planner statistics of the articles table,
+// which autovacuum may leave stale after a large import or purge
+func (s Service) AnalyzeArticles(ctx context.Context) error {
+	logCtx := fmt.Sprintf("service.AnalyzeArticles")
+
+	if err := s.repository.AnalyzeArticles(ctx); err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.repository.AnalyzeArticles")
+		return err
+	}
+	return nil
+}
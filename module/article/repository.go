@@ -2,49 +2,101 @@ package article
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
+	"go-bunrouter-gorm-example/infrastructure/database"
+	"go-bunrouter-gorm-example/infrastructure/jobs"
 	"go-bunrouter-gorm-example/module/primitive"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type RepositoryInterface interface {
 	CreateArticle(ctx context.Context, payload primitive.Article) (primitive.Article, error)
+	CreateArticles(ctx context.Context, payload []primitive.Article, batchSize int) ([]primitive.Article, error)
 	CountArticle(ctx context.Context, param primitive.ParameterFindArticle) (int64, error)
 	FindListArticle(ctx context.Context, param primitive.ParameterFindArticle) ([]primitive.Article, error)
 	FindArticleByID(ctx context.Context, articleID int64) (primitive.Article, error)
+	StreamArticles(ctx context.Context, param primitive.ParameterFindArticle, columns []string, statementTimeout time.Duration, fn func(data primitive.Article) error) error
+	UpdateArticle(ctx context.Context, articleID int64, payload primitive.Article) (primitive.Article, error)
+	DeleteArticle(ctx context.Context, articleID int64) error
+	// Transaction runs fn with a repository bound to a single transaction on
+	// the primary, it commits when fn returns nil
+	Transaction(ctx context.Context, fn func(repository RepositoryInterface) error) error
 	SetParamQueryToOrderByQuery(orderBy string) string
+	SaveImportProgress(ctx context.Context, jobID int64, progress string) error
+	PurgeDeletedArticles(ctx context.Context, deletedBefore time.Time, limit int) (int64, error)
+	AnalyzeArticles(ctx context.Context) error
 }
 
+// Repository writes to the primary and reads through the resolver, which
+// routes to a healthy replica when any is configured
 type Repository struct {
-	db *gorm.DB
+	resolver *database.Resolver
+	// tx is set on the repository handed out by Transaction, every query
+	// then runs on it
+	tx *gorm.DB
 }
 
-func NewRepository(db *gorm.DB) *Repository {
+func NewRepository(resolver *database.Resolver) *Repository {
 	return &Repository{
-		db: db,
+		resolver: resolver,
+	}
+}
+
+func (r *Repository) writer(ctx context.Context) *gorm.DB {
+	if r.tx != nil {
+		return r.tx.WithContext(ctx)
+	}
+	return r.resolver.Writer(ctx)
+}
+
+func (r *Repository) reader(ctx context.Context) *gorm.DB {
+	if r.tx != nil {
+		return r.tx.WithContext(ctx)
 	}
+	return r.resolver.Reader(ctx)
+}
+
+func (r *Repository) Transaction(ctx context.Context, fn func(repository RepositoryInterface) error) error {
+	return r.writer(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&Repository{resolver: r.resolver, tx: tx})
+	})
 }
 
 func (r *Repository) CreateArticle(ctx context.Context, payload primitive.Article) (primitive.Article, error) {
-	if err := r.db.WithContext(ctx).Table("articles").Create(&payload).Error; err != nil {
+	if err := r.writer(ctx).Table("articles").Create(&payload).Error; err != nil {
 		return payload, err
 	}
 	return payload, nil
 }
 
-func (r *Repository) CountArticle(ctx context.Context, param primitive.ParameterFindArticle) (int64, error) {
-	var count int64
-	query := r.db.WithContext(ctx).Table("articles")
-	query.Where(`"deleted_at" is null`)
+func (r *Repository) CreateArticles(ctx context.Context, payload []primitive.Article, batchSize int) ([]primitive.Article, error) {
+	if err := r.writer(ctx).Table("articles").CreateInBatches(&payload, batchSize).Error; err != nil {
+		return payload, err
+	}
+	return payload, nil
+}
+
+// filterArticles restricts query to the live articles matching param
+func filterArticles(query *gorm.DB, param primitive.ParameterFindArticle) *gorm.DB {
+	query = query.Where(`"deleted_at" is null`)
 	if param.Author != "" {
-		query.Where(`"author" ILIKE ?`, "%"+param.Author+"%")
+		query = query.Where(`"author" ILIKE ?`, "%"+param.Author+"%")
 	}
 	if param.Query != "" {
-		query.Where(`"title" ILIKE ? or "body" ILIKE ?`, "%"+param.Query+"%", "%"+param.Query+"%")
+		query = query.Where(`"title" ILIKE ? or "body" ILIKE ?`, "%"+param.Query+"%", "%"+param.Query+"%")
 	}
-	err := query.Count(&count).Error
+	return query
+}
+
+func (r *Repository) CountArticle(ctx context.Context, param primitive.ParameterFindArticle) (int64, error) {
+	var count int64
+	err := filterArticles(r.reader(ctx).Table("articles"), param).Count(&count).Error
 	if err != nil {
 		return 0, err
 	}
@@ -53,15 +105,8 @@ func (r *Repository) CountArticle(ctx context.Context, param primitive.Parameter
 
 func (r *Repository) FindListArticle(ctx context.Context, param primitive.ParameterFindArticle) ([]primitive.Article, error) {
 	var listData []primitive.Article
-	query := r.db.WithContext(ctx).Table("articles")
-	query.Where(`"deleted_at" is null`)
-	if param.Author != "" {
-		query.Where(`"author" ILIKE ?`, "%"+param.Author+"%")
-	}
-	if param.Query != "" {
-		query.Where(`"title" ILIKE ? or "body" ILIKE ?`, "%"+param.Query+"%", "%"+param.Query+"%")
-	}
-	err := query.Offset(param.Offset).
+	err := filterArticles(r.reader(ctx).Table("articles"), param).
+		Offset(param.Offset).
 		Limit(param.PageSize).
 		Order(strings.Join([]string{param.SortBy, param.SortOrder}, " ")).
 		Find(&listData).
@@ -72,6 +117,39 @@ func (r *Repository) FindListArticle(ctx context.Context, param primitive.Parame
 	return listData, nil
 }
 
+// StreamArticles reads every live article matching param through a cursor
+// and hands them to fn one at a time, only the given columns are filled.
+// The query runs in a read only transaction whose statement timeout is
+// statementTimeout, 0 lifts it, since a large export outlives the default.
+func (r *Repository) StreamArticles(ctx context.Context, param primitive.ParameterFindArticle, columns []string, statementTimeout time.Duration, fn func(data primitive.Article) error) error {
+	return r.reader(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf(`set local statement_timeout = %d`, statementTimeout.Milliseconds())).Error; err != nil {
+			return err
+		}
+
+		rows, err := filterArticles(tx.Table("articles"), param).
+			Select(columns).
+			Order(strings.Join([]string{param.SortBy, param.SortOrder}, " ")).
+			Order("id").
+			Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var data primitive.Article
+			if err = tx.ScanRows(rows, &data); err != nil {
+				return err
+			}
+			if err = fn(data); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	}, &sql.TxOptions{ReadOnly: true})
+}
+
 func (r *Repository) SetParamQueryToOrderByQuery(orderBy string) string {
 	var result string
 	switch orderBy {
@@ -93,7 +171,7 @@ func (r *Repository) SetParamQueryToOrderByQuery(orderBy string) string {
 
 func (r *Repository) FindArticleByID(ctx context.Context, articleID int64) (primitive.Article, error) {
 	var data primitive.Article
-	err := r.db.WithContext(ctx).
+	err := r.reader(ctx).
 		Table("articles").
 		Where(`"deleted_at" is null and id = ?`, articleID).
 		First(&data).
@@ -103,3 +181,80 @@ func (r *Repository) FindArticleByID(ctx context.Context, articleID int64) (prim
 	}
 	return data, nil
 }
+
+// UpdateArticle replaces the fields of a live article, a missing or deleted
+// article is gorm.ErrRecordNotFound
+func (r *Repository) UpdateArticle(ctx context.Context, articleID int64, payload primitive.Article) (primitive.Article, error) {
+	var data primitive.Article
+	result := r.writer(ctx).
+		Table("articles").
+		Model(&data).
+		Clauses(clause.Returning{}).
+		Where(`"deleted_at" is null and id = ?`, articleID).
+		Updates(map[string]interface{}{
+			"author":     payload.Author,
+			"title":      payload.Title,
+			"body":       payload.Body,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return primitive.Article{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return primitive.Article{}, gorm.ErrRecordNotFound
+	}
+	return data, nil
+}
+
+// DeleteArticle soft deletes a live article, a missing or already deleted
+// article is gorm.ErrRecordNotFound
+func (r *Repository) DeleteArticle(ctx context.Context, articleID int64) error {
+	result := r.writer(ctx).
+		Table("articles").
+		Where(`"deleted_at" is null and id = ?`, articleID).
+		Update("deleted_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SaveImportProgress records the progress of a running import job, run it
+// in the transaction of the rows it accounts for so both commit together. A
+// job that is no longer running, e.g. cancelled, is gorm.ErrRecordNotFound.
+func (r *Repository) SaveImportProgress(ctx context.Context, jobID int64, progress string) error {
+	result := r.writer(ctx).
+		Table("jobs").
+		Where(`id = ? and status = ?`, jobID, jobs.StatusRunning).
+		Updates(map[string]interface{}{
+			"progress":   progress,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// PurgeDeletedArticles removes up to limit articles soft deleted before
+// deletedBefore and returns how many it removed, a small batch keeps the
+// row locks short
+func (r *Repository) PurgeDeletedArticles(ctx context.Context, deletedBefore time.Time, limit int) (int64, error) {
+	result := r.writer(ctx).Exec(`delete from articles where id in (
+	select id from articles where "deleted_at" is not null and "deleted_at" < ? limit ?)`, deletedBefore, limit)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// AnalyzeArticles refreshes the planner statistics of the articles table
+func (r *Repository) AnalyzeArticles(ctx context.Context) error {
+	return r.writer(ctx).Exec(`analyze articles`).Error
+}
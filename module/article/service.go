@@ -2,38 +2,163 @@ package article
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"time"
+	"strconv"
 
+	"go-bunrouter-gorm-example/infrastructure/cache"
 	"go-bunrouter-gorm-example/infrastructure/config"
 	"go-bunrouter-gorm-example/infrastructure/httplib"
+	"go-bunrouter-gorm-example/infrastructure/jobs"
+	"go-bunrouter-gorm-example/infrastructure/lifecycle"
 	logger "go-bunrouter-gorm-example/infrastructure/log"
 	"go-bunrouter-gorm-example/infrastructure/redis"
 	"go-bunrouter-gorm-example/module/primitive"
 	"go-bunrouter-gorm-example/utils"
+
+	"gorm.io/gorm"
 )
 
 const (
 	redisFinaleKeyArticle     = "article:%d"
 	redisListFinaleKeyArticle = "article_list"
+	// every list key embeds the generation stored here, bumping it on a
+	// write makes all the cached pages unreachable at once
+	redisListGenerationKeyArticle = "article_list:generation"
 )
 
+// listCacheVersion is bumped whenever listCacheEnvelope changes shape, an
+// envelope of another version is ignored
+const listCacheVersion = 1
+
+// listCacheEnvelope is a cached list page, it carries the total count so a
+// cached page answers with the same pagination metadata as the database
+type listCacheEnvelope struct {
+	Version     int                     `json:"version"`
+	Fingerprint string                  `json:"fingerprint"`
+	Total       int64                   `json:"total"`
+	Items       []primitive.ArticleResp `json:"items"`
+}
+
+// listFingerprint identifies a list query, the fields are length prefixed so
+// values containing separators cannot collide
+func listFingerprint(param primitive.ParameterFindArticle) string {
+	hash := sha256.New()
+	for _, field := range []string{
+		param.Query,
+		param.Author,
+		strconv.Itoa(param.PageSize),
+		strconv.Itoa(param.Offset),
+		param.SortBy,
+		param.SortOrder,
+	} {
+		fmt.Fprintf(hash, "%d:%s;", len(field), field)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
 type InterfaceService interface {
 	GetListArticle(ctx context.Context, param primitive.ParameterArticleHandler, pagination *httplib.Query) (resp []primitive.ArticleResp, count int64, err error)
 	RecordArticle(ctx context.Context, payload primitive.ArticleReq) (primitive.ArticleResp, error)
 	GetDetailArticle(ctx context.Context, articleID int64) (primitive.ArticleResp, error)
+	BatchArticle(ctx context.Context, req primitive.ArticleBatchReq) (primitive.ArticleBatchResp, error)
+	ExportArticle(ctx context.Context, param primitive.ParameterArticleHandler, sort *httplib.Query, columns []string, fn func(data primitive.ArticleResp) error) error
+	ImportArticle(ctx context.Context, req primitive.ArticleImportReq) (primitive.JobResp, error)
+	ImportJob(ctx context.Context, job *jobs.Job, params primitive.ArticleImportParams) error
+	PurgeDeletedArticles(ctx context.Context) (primitive.ArticlePurgeResult, error)
+	WarmListCache(ctx context.Context) (primitive.ArticleWarmResult, error)
+	AnalyzeArticles(ctx context.Context) error
 }
 
 type Service struct {
 	repository RepositoryInterface
-	redis      redis.LibInterface
+	redis      cache.Lib
+	cache      *cache.Guard
+	codec      cache.Codec
+	// queue runs the import jobs
+	queue jobs.Enqueuer
 }
 
-func NewService(repository RepositoryInterface, redisLib redis.LibInterface) InterfaceService {
+func NewService(repository RepositoryInterface, redisLib cache.Lib, locker redis.Locker, background lifecycle.Spawner, queue jobs.Enqueuer) InterfaceService {
+	codec, err := cache.CodecByName(config.Conf.Cache.Codec)
+	if err != nil {
+		codec = cache.JSON
+	}
 	return &Service{
 		repository: repository,
 		redis:      redisLib,
+		cache: cache.NewGuard("article", redisLib, background, cache.Options{
+			StaleTTL:         config.Conf.Cache.StaleTTL,
+			Lock:             config.Conf.Cache.Lock,
+			Locker:           locker,
+			LockTTL:          config.Conf.Cache.LockTTL,
+			MaxPendingWrites: config.Conf.Cache.MaxPendingWrites,
+		}),
+		codec: codec,
+		queue: queue,
+	}
+}
+
+// articleEntity is the caching policy of a single article, the ttls are hot
+// reloadable so they are read on every call
+func (s Service) articleEntity() cache.Entity {
+	conf := config.Current().Cache
+	return cache.Entity{
+		TTL:         conf.ArticleTTL,
+		NegativeTTL: conf.ArticleNotFoundTTL,
+		NotFound:    gorm.ErrRecordNotFound,
+		Codec:       s.codec,
+	}
+}
+
+// articleListEntity is the caching policy of a list page
+func (s Service) articleListEntity() cache.Entity {
+	return cache.Entity{
+		TTL:   config.Current().Cache.ArticleListTTL,
+		Codec: s.codec,
+	}
+}
+
+// listGeneration returns the current generation of the list cache, a
+// missing counter is generation 0
+func (s Service) listGeneration(ctx context.Context) (string, error) {
+	generation, err := s.redis.GetContext(ctx, redisListGenerationKeyArticle)
+	if errors.Is(err, redis.ErrNil) {
+		return "0", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return generation, nil
+}
+
+// invalidateList bumps the list generation, it runs before the write is
+// acknowledged so the client never reads a page cached before its write
+func (s Service) invalidateList(ctx context.Context, logCtx string) {
+	if !s.cacheEnabled() {
+		return
+	}
+	if _, err := s.redis.Incr(redisListGenerationKeyArticle); err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.redis.Incr")
+	}
+}
+
+// cacheEnabled reports whether a cache is configured and its circuit breaker
+// lets calls through, an open breaker sends every read to the database
+func (s Service) cacheEnabled() bool {
+	return s.redis != nil && redis.Available(s.redis)
+}
+
+func toArticleResp(data primitive.Article) primitive.ArticleResp {
+	return primitive.ArticleResp{
+		ID:        data.ID,
+		Author:    data.Author,
+		Title:     data.Title,
+		Body:      data.Body,
+		CreatedAt: data.CreatedAt,
+		UpdatedAt: data.UpdatedAt,
 	}
 }
 
@@ -48,33 +173,20 @@ func (s Service) RecordArticle(ctx context.Context, payload primitive.ArticleReq
 
 	data, err := s.repository.CreateArticle(ctx, payloadDb)
 	if err != nil {
-		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "u.repository.CountArticle")
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "u.repository.CreateArticle")
 		return primitive.ArticleResp{}, err
 	}
 
-	//set data to redis on goroutine
-	if config.Conf.Redis.EnableRedis && s.redis != nil {
-		go func() {
-			dataBytes, errMarshall := json.Marshal(data)
-			if errMarshall != nil {
-				logger.Error(ctx, utils.ErrorLogFormat, errMarshall.Error(), logCtx, "json.Marshal")
-			}
-			redisFinaleKey := fmt.Sprintf(redisFinaleKeyArticle, data.ID)
-			errSetToRedis := s.redis.Set(redisFinaleKey, dataBytes, time.Minute)
-			if errSetToRedis != nil {
-				logger.Error(ctx, utils.ErrorLogFormat, errSetToRedis.Error(), logCtx, "s.redis.Set")
-			}
-			fmt.Printf("success SET on redis by key: %s\n", redisFinaleKey)
-		}()
-	}
+	//the new article belongs on the cached list pages
+	s.invalidateList(ctx, logCtx)
 
-	payloadResp := primitive.ArticleResp{
-		ID:        data.ID,
-		Author:    data.Author,
-		Title:     data.Title,
-		Body:      data.Body,
-		CreatedAt: data.CreatedAt,
-		UpdatedAt: data.UpdatedAt,
+	payloadResp := toArticleResp(data)
+
+	//write the article through to the cache, it also replaces a cached miss
+	//of the same id
+	errPut := cache.Put(ctx, s.cache, s.articleEntity(), fmt.Sprintf(redisFinaleKeyArticle, data.ID), payloadResp)
+	if errPut != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, errPut.Error(), logCtx, "cache.Put")
 	}
 
 	return payloadResp, nil
@@ -84,9 +196,44 @@ func (s Service) RecordArticle(ctx context.Context, payload primitive.ArticleReq
 func (s Service) GetListArticle(ctx context.Context, param primitive.ParameterArticleHandler, pagination *httplib.Query) (resp []primitive.ArticleResp, count int64, err error) {
 	logCtx := fmt.Sprintf("service.GetListArticle")
 
-	emptySliceDataArticle := make([]primitive.ArticleResp, 0)
+	paramQuery := s.listQuery(param, pagination)
+	fingerprint := listFingerprint(paramQuery)
+	cacheKey, err := s.listCacheKey(ctx, fingerprint)
+	if err != nil {
+		//the generation is unknown, read the page without the cache
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.listCacheKey")
+		envelope, err := s.loadListArticle(ctx, logCtx, paramQuery, fingerprint)
+		if err != nil {
+			return nil, 0, err
+		}
+		return envelope.Items, envelope.Total, nil
+	}
 
-	paramQuery := primitive.ParameterFindArticle{
+	envelope, err := cache.GetOrLoad(ctx, s.cache, s.articleListEntity(), cacheKey, func(ctx context.Context) (listCacheEnvelope, error) {
+		return s.loadListArticle(ctx, logCtx, paramQuery, fingerprint)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// an envelope of another version or query is treated as a miss, the page
+	// read again replaces it
+	if envelope.Version != listCacheVersion || envelope.Fingerprint != fingerprint {
+		envelope, err = s.loadListArticle(ctx, logCtx, paramQuery, fingerprint)
+		if err != nil {
+			return nil, 0, err
+		}
+		if errPut := cache.Put(ctx, s.cache, s.articleListEntity(), cacheKey, envelope); errPut != nil {
+			logger.Error(ctx, utils.ErrorLogFormat, errPut.Error(), logCtx, "cache.Put")
+		}
+	}
+
+	return envelope.Items, envelope.Total, nil
+}
+
+// listQuery is the repository query of a list page
+func (s Service) listQuery(param primitive.ParameterArticleHandler, pagination *httplib.Query) primitive.ParameterFindArticle {
+	return primitive.ParameterFindArticle{
 		Query:     param.Query,
 		Author:    param.Author,
 		PageSize:  pagination.GetSize(),
@@ -94,134 +241,88 @@ func (s Service) GetListArticle(ctx context.Context, param primitive.ParameterAr
 		SortBy:    s.repository.SetParamQueryToOrderByQuery(pagination.GetOrderBy()),
 		SortOrder: pagination.GetSortOrder(),
 	}
+}
 
-	// Generate a unique cache key based on the pagination parameters
-	cacheKey := fmt.Sprintf("%s:%s:%s:%d:%d:%s:%s",
-		redisListFinaleKeyArticle,
-		paramQuery.Query,
-		paramQuery.Author,
-		paramQuery.PageSize,
-		paramQuery.Offset,
-		paramQuery.SortBy,
-		paramQuery.SortOrder)
-
-	// Check if the data exists in the Redis cache
-	if config.Conf.Redis.EnableRedis && s.redis != nil {
-		cacheData := s.redis.Get(cacheKey)
-		if cacheData != "" {
-			// If data exists in cache, decode it and return
-			if err := json.Unmarshal([]byte(cacheData), &resp); err != nil {
-				logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "json.Unmarshal")
-			}
-			count = int64(len(resp))
-			return resp, count, nil
+// listCacheKey is a unique cache key based on the list generation and the
+// fingerprint of the query
+func (s Service) listCacheKey(ctx context.Context, fingerprint string) (string, error) {
+	generation := "0"
+	if s.cacheEnabled() {
+		var err error
+		generation, err = s.listGeneration(ctx)
+		if err != nil {
+			return "", err
 		}
 	}
+	return fmt.Sprintf("%s:%s:%s", redisListFinaleKeyArticle, generation, fingerprint), nil
+}
+
+// loadListArticle reads a list page and its total count from the database
+func (s Service) loadListArticle(ctx context.Context, logCtx string, paramQuery primitive.ParameterFindArticle, fingerprint string) (listCacheEnvelope, error) {
+	envelope := listCacheEnvelope{
+		Version:     listCacheVersion,
+		Fingerprint: fingerprint,
+		Items:       make([]primitive.ArticleResp, 0),
+	}
 
-	// Data not found in cache, query the database
-	count, err = s.repository.CountArticle(ctx, paramQuery)
+	count, err := s.repository.CountArticle(ctx, paramQuery)
 	if err != nil {
 		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "u.repository.CountArticle")
-		return
+		return listCacheEnvelope{}, err
 	}
 
 	listData, err := s.repository.FindListArticle(ctx, paramQuery)
 	if err != nil {
 		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "u.repository.FindListArticle")
-		return
+		return listCacheEnvelope{}, err
 	}
 
-	if count == 0 && len(listData) == 0 {
-		return emptySliceDataArticle, 0, nil
+	envelope.Total = count
+	for _, val := range listData {
+		envelope.Items = append(envelope.Items, toArticleResp(val))
 	}
+	return envelope, nil
+}
 
-	var list []primitive.ArticleResp
-	if len(listData) > 0 {
-		for _, val := range listData {
-			list = append(list, primitive.ArticleResp{
-				ID:        val.ID,
-				Author:    val.Author,
-				Title:     val.Title,
-				Body:      val.Body,
-				CreatedAt: val.CreatedAt,
-				UpdatedAt: val.UpdatedAt,
-			})
-		}
-		resp = list
-	}
-
-	// Store data in Redis cache for next time
-	if config.Conf.Redis.EnableRedis && s.redis != nil {
-		if len(resp) > 0 {
-			go func() {
-				cacheDataBytes, errMarshal := json.Marshal(resp)
-				if errMarshal != nil {
-					logger.Error(ctx, utils.ErrorLogFormat, errMarshal.Error(), logCtx, "json.Marshal")
-				}
-				// Cache data for a reasonable amount of time (e.g., 1 hour)
-				errSetDataRedis := s.redis.Set(cacheKey, cacheDataBytes, time.Minute)
-				if errSetDataRedis != nil {
-					logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.redis.Set")
-				}
-				fmt.Printf("success SET on redis by key: %s\n", cacheKey)
-			}()
-		}
+// ExportArticle hands every article matching param to fn in the order of
+// the list, reading only the given columns. It bypasses the cache and never
+// holds more than one row.
+func (s Service) ExportArticle(ctx context.Context, param primitive.ParameterArticleHandler, sort *httplib.Query, columns []string, fn func(data primitive.ArticleResp) error) error {
+	logCtx := fmt.Sprintf("service.ExportArticle")
+
+	paramQuery := primitive.ParameterFindArticle{
+		Query:     param.Query,
+		Author:    param.Author,
+		SortBy:    s.repository.SetParamQueryToOrderByQuery(sort.GetOrderBy()),
+		SortOrder: sort.GetSortOrder(),
 	}
 
-	return resp, count, nil
+	err := s.repository.StreamArticles(ctx, paramQuery, columns, config.Conf.Articles.ExportStatementTimeout, func(data primitive.Article) error {
+		return fn(toArticleResp(data))
+	})
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.repository.StreamArticles")
+		return err
+	}
+	return nil
 }
 
 func (s Service) GetDetailArticle(ctx context.Context, articleID int64) (primitive.ArticleResp, error) {
 	logCtx := fmt.Sprintf("service.GetDetailArticle")
 
-	var resp primitive.ArticleResp
 	cacheKey := fmt.Sprintf(redisFinaleKeyArticle, articleID)
 
-	// Check if the data exists in the Redis cache
-	if config.Conf.Redis.EnableRedis && s.redis != nil {
-		cacheData := s.redis.Get(cacheKey)
-		if cacheData != "" {
-			// If data exists in cache, decode it and return
-			err := json.Unmarshal([]byte(cacheData), &resp)
-			if err != nil {
-				logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "json.Unmarshal")
+	// a missing id is cached too, so probing unknown ids does not reach
+	// the database every time
+	return cache.GetOrLoad(ctx, s.cache, s.articleEntity(), cacheKey, func(ctx context.Context) (primitive.ArticleResp, error) {
+		data, err := s.repository.FindArticleByID(ctx, articleID)
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "u.repository.FindArticleByID")
 			}
-			return resp, nil
+			return primitive.ArticleResp{}, err
 		}
-	}
-
-	data, err := s.repository.FindArticleByID(ctx, articleID)
-	if err != nil {
-		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "u.repository.FindListArticle")
-		return primitive.ArticleResp{}, err
-	}
-
-	if config.Conf.Redis.EnableRedis && s.redis != nil {
-		if data.ID > 0 {
-			go func() {
-				cacheDataBytes, errMarshal := json.Marshal(data)
-				if errMarshal != nil {
-					logger.Error(ctx, utils.ErrorLogFormat, errMarshal.Error(), logCtx, "json.Marshal")
-				}
-				// Cache data for a reasonable amount of time (e.g., 1 hour)
-				errSetDataRedis := s.redis.Set(cacheKey, cacheDataBytes, time.Minute)
-				if errSetDataRedis != nil {
-					logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.redis.Set")
-				}
-				fmt.Printf("success SET on redis by key: %s\n", cacheKey)
-			}()
-		}
-	}
-
-	resp = primitive.ArticleResp{
-		ID:        data.ID,
-		Author:    data.Author,
-		Title:     data.Title,
-		Body:      data.Body,
-		CreatedAt: data.CreatedAt,
-		UpdatedAt: data.UpdatedAt,
-	}
-
-	return resp, nil
+		return toArticleResp(data), nil
+	})
 
 }
@@ -24,19 +24,42 @@ func NewHttp(serviceHealth InterfaceService) InterfaceHttp {
 
 type InterfaceHttp interface {
 	GroupHealth(group *bunrouter.Group)
+	GroupProbe(group *bunrouter.Group)
 }
 
 func (h *Http) GroupHealth(g *bunrouter.Group) {
 	g.GET("/ping", h.Ping)
-	g.GET("/check", h.HealthCheckApi)
+	g.GET("/check", h.Readiness)
+}
+
+// GroupProbe registers the kubernetes style probes, they are meant to be
+// mounted on the root router so they are not subject to the api rate limit.
+func (h *Http) GroupProbe(g *bunrouter.Group) {
+	g.GET("/livez", h.Liveness)
+	g.GET("/readyz", h.Readiness)
+	g.GET("/startupz", h.Startup)
 }
 
 func (h *Http) Ping(w http.ResponseWriter, r bunrouter.Request) error {
 	return httplib.SetSuccessResponse(w, http.StatusOK, http.StatusText(http.StatusOK), "pong")
 }
 
-func (h *Http) HealthCheckApi(w http.ResponseWriter, r bunrouter.Request) error {
-	logCtx := "handler.HealthCheckApi"
+func (h *Http) Liveness(w http.ResponseWriter, r bunrouter.Request) error {
+	logCtx := "handler.Liveness"
+	ctx := r.Context()
+
+	if h.serviceHealth == nil {
+		err := errors.New("dependency service health to handler health is nil")
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceHealth")
+		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
+	}
+
+	resp := h.serviceHealth.Liveness(ctx)
+	return httplib.SetSuccessResponse(w, http.StatusOK, http.StatusText(http.StatusOK), resp)
+}
+
+func (h *Http) Readiness(w http.ResponseWriter, r bunrouter.Request) error {
+	logCtx := "handler.Readiness"
 	ctx := r.Context()
 
 	if h.serviceHealth == nil {
@@ -45,10 +68,26 @@ func (h *Http) HealthCheckApi(w http.ResponseWriter, r bunrouter.Request) error
 		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
 	}
 
-	resp, err := h.serviceHealth.CheckUpTime(ctx)
-	if err != nil {
-		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceHealth.CheckUpTime")
+	resp, ok := h.serviceHealth.Readiness(ctx)
+	if !ok {
+		return httplib.SetCustomResponse(w, http.StatusServiceUnavailable, primitive.ServiceNotReady, resp, nil)
+	}
+	return httplib.SetSuccessResponse(w, http.StatusOK, http.StatusText(http.StatusOK), resp)
+}
+
+func (h *Http) Startup(w http.ResponseWriter, r bunrouter.Request) error {
+	logCtx := "handler.Startup"
+	ctx := r.Context()
+
+	if h.serviceHealth == nil {
+		err := errors.New("dependency service health to handler health is nil")
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceHealth")
 		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
 	}
+
+	resp, ok := h.serviceHealth.Startup(ctx)
+	if !ok {
+		return httplib.SetCustomResponse(w, http.StatusServiceUnavailable, primitive.ServiceNotStarted, resp, nil)
+	}
 	return httplib.SetSuccessResponse(w, http.StatusOK, http.StatusText(http.StatusOK), resp)
 }
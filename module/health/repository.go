@@ -25,7 +25,7 @@ func (r Repository) CheckUpTimeDB(ctx context.Context) (err error) {
 		return err
 	}
 
-	err = db.Ping()
+	err = db.PingContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -3,55 +3,266 @@ package health
 import (
 	"context"
 	"errors"
-	"go-bunrouter-gorm-example/module/primitive"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/go-redis/redis"
+	"go-bunrouter-gorm-example/infrastructure/breaker"
 	logger "go-bunrouter-gorm-example/infrastructure/log"
+	"go-bunrouter-gorm-example/module/primitive"
+)
+
+const (
+	// DefaultCheckTimeout is used when a checker is registered without a timeout
+	DefaultCheckTimeout = 2 * time.Second
+
+	statusUp   = "up"
+	statusDown = "down"
+)
+
+var (
+	ErrCheckTimeout = errors.New("health check timed out")
+	ErrShuttingDown = errors.New("server is shutting down")
+	ErrNotStarted   = errors.New("server has not finished starting")
 )
 
+// Checker is a single dependency check that takes part in the readiness
+// and startup probes. An optional checker is reported but does not flip
+// the probe, e.g. a read replica the app can route around.
+type Checker struct {
+	Name     string
+	Timeout  time.Duration
+	Optional bool
+	Check    func(ctx context.Context) error
+}
+
+// BreakerChecker reports a circuit breaker as an optional check that fails
+// while the breaker is open, the dependency check itself decides readiness
+func BreakerChecker(b *breaker.Breaker) Checker {
+	return Checker{
+		Name:     "breaker-" + b.Name(),
+		Optional: true,
+		Check: func(context.Context) error {
+			if b.State() == breaker.StateOpen {
+				return fmt.Errorf("%w: %s", breaker.ErrOpen, b.Name())
+			}
+			return nil
+		},
+	}
+}
+
 type InterfaceService interface {
-	CheckUpTime(ctx context.Context) (resp primitive.HealthResp, err error)
+	RegisterChecker(checker Checker)
+	Liveness(ctx context.Context) primitive.ProbeResp
+	Readiness(ctx context.Context) (resp primitive.ProbeResp, ok bool)
+	Startup(ctx context.Context) (resp primitive.ProbeResp, ok bool)
+	MarkStarted()
+	MarkShuttingDown()
+}
+
+type checkState struct {
+	checker     Checker
+	healthy     bool
+	latency     time.Duration
+	lastError   string
+	lastErrorAt time.Time
+	lastChecked time.Time
+}
+
+// probeReport is a readiness or startup result as it is reused
+type probeReport struct {
+	resp     primitive.ProbeResp
+	ok       bool
+	loadedAt time.Time
 }
 
 type Service struct {
-	repository  RepositoryInterface
-	redisClient *redis.Client
+	startedAt    time.Time
+	started      atomic.Bool
+	shuttingDown atomic.Bool
+
+	mu     sync.Mutex
+	checks map[string]*checkState
+
+	// reports are reused for reportTTL so a burst of probes runs the checks
+	// once, a concurrent probe waits for the report being loaded
+	reportTTL time.Duration
+	reportMu  sync.Mutex
+	reports   map[string]probeReport
 }
 
-func NewService(repository RepositoryInterface, redisClient *redis.Client) InterfaceService {
+// NewService creates the health service, a zero reportTTL runs the checks
+// on every probe
+func NewService(reportTTL time.Duration) InterfaceService {
 	return &Service{
-		repository:  repository,
-		redisClient: redisClient,
+		startedAt: time.Now(),
+		checks:    make(map[string]*checkState),
+		reportTTL: reportTTL,
+		reports:   make(map[string]probeReport),
+	}
+}
+
+// RegisterChecker adds a dependency check, replacing any check previously
+// registered under the same name.
+func (u *Service) RegisterChecker(checker Checker) {
+	if checker.Timeout <= 0 {
+		checker.Timeout = DefaultCheckTimeout
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.checks[checker.Name] = &checkState{checker: checker}
+}
+
+func (u *Service) MarkStarted() {
+	u.started.Store(true)
+}
+
+func (u *Service) MarkShuttingDown() {
+	u.shuttingDown.Store(true)
+}
+
+func (u *Service) Liveness(ctx context.Context) primitive.ProbeResp {
+	return primitive.ProbeResp{
+		Status: statusUp,
+		Uptime: time.Since(u.startedAt).Round(time.Second).String(),
+	}
+}
+
+func (u *Service) Readiness(ctx context.Context) (primitive.ProbeResp, bool) {
+	resp, ok := u.cachedChecks(ctx, "health:readiness")
+	if u.shuttingDown.Load() {
+		resp.Status = statusDown
+		resp.Reason = ErrShuttingDown.Error()
+		return resp, false
+	}
+	return resp, ok
+}
+
+func (u *Service) Startup(ctx context.Context) (primitive.ProbeResp, bool) {
+	if !u.started.Load() {
+		return primitive.ProbeResp{
+			Status: statusDown,
+			Uptime: time.Since(u.startedAt).Round(time.Second).String(),
+			Reason: ErrNotStarted.Error(),
+		}, false
+	}
+	return u.cachedChecks(ctx, "health:startup")
+}
+
+// cachedChecks runs the checks at most once per reportTTL for key
+func (u *Service) cachedChecks(ctx context.Context, key string) (primitive.ProbeResp, bool) {
+	if u.reportTTL <= 0 {
+		return u.runChecks(ctx)
+	}
+
+	u.reportMu.Lock()
+	defer u.reportMu.Unlock()
+	report, ok := u.reports[key]
+	if !ok || time.Since(report.loadedAt) >= u.reportTTL {
+		resp, healthy := u.runChecks(ctx)
+		report = probeReport{resp: resp, ok: healthy, loadedAt: time.Now()}
+		u.reports[key] = report
 	}
+	report.resp.Uptime = time.Since(u.startedAt).Round(time.Second).String()
+	return report.resp, report.ok
 }
 
-func (u *Service) CheckUpTime(ctx context.Context) (primitive.HealthResp, error) {
-	ctxName := "CheckUpTime"
+// runChecks executes every registered checker concurrently, each bounded by
+// its own timeout, and records the outcome for the next report.
+func (u *Service) runChecks(ctx context.Context) (primitive.ProbeResp, bool) {
+	u.mu.Lock()
+	states := make([]*checkState, 0, len(u.checks))
+	for _, state := range u.checks {
+		states = append(states, state)
+	}
+	u.mu.Unlock()
 
-	if u.repository == nil {
-		err := errors.New("repository doesn't initiate on the boot file")
-		return primitive.HealthResp{}, err
+	var wg sync.WaitGroup
+	for _, state := range states {
+		wg.Add(1)
+		go func(state *checkState) {
+			defer wg.Done()
+			u.runCheck(ctx, state)
+		}(state)
 	}
+	wg.Wait()
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].checker.Name < states[j].checker.Name
+	})
 
-	if u.redisClient == nil {
-		err := errors.New("redis client doesn't initiate on the boot file")
-		return primitive.HealthResp{}, err
+	ok := true
+	resp := primitive.ProbeResp{
+		Status: statusUp,
+		Uptime: time.Since(u.startedAt).Round(time.Second).String(),
+		Checks: make(map[string]primitive.HealthCheckResp, len(states)),
 	}
 
-	errCheckDb := u.repository.CheckUpTimeDB(ctx)
-	if errCheckDb != nil {
-		logger.Error(ctx, ctxName, "got error when %s : %v", ctxName, errCheckDb)
-		return primitive.HealthResp{}, errCheckDb
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, state := range states {
+		check := primitive.HealthCheckResp{
+			Status:        statusUp,
+			LatencyMs:     state.latency.Milliseconds(),
+			LastError:     state.lastError,
+			LastCheckedAt: state.lastChecked,
+			Optional:      state.checker.Optional,
+		}
+		if !state.lastErrorAt.IsZero() {
+			lastErrorAt := state.lastErrorAt
+			check.LastErrorAt = &lastErrorAt
+		}
+		if !state.healthy {
+			check.Status = statusDown
+			if !state.checker.Optional {
+				ok = false
+			}
+		}
+		resp.Checks[state.checker.Name] = check
+	}
+	if !ok {
+		resp.Status = statusDown
 	}
 
-	errCheckRedis := u.redisClient.Ping().Err()
-	if errCheckRedis != nil {
-		logger.Error(ctx, ctxName, "got error when %s : %v", ctxName, errCheckRedis)
-		return primitive.HealthResp{}, errCheckRedis
+	return resp, ok
+}
+
+func (u *Service) runCheck(ctx context.Context, state *checkState) {
+	ctxName := "health.runCheck"
+
+	ctx, cancel := context.WithTimeout(ctx, state.checker.Timeout)
+	defer cancel()
+
+	// the check runs on its own goroutine so a dependency that ignores the
+	// context still can not hold the probe past its timeout
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		done <- state.checker.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("%w after %s", ErrCheckTimeout, state.checker.Timeout)
 	}
+	latency := time.Since(start)
 
-	return primitive.HealthResp{
-		Db:    "healthy",
-		Redis: "healthy",
-	}, nil
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	state.latency = latency
+	state.lastChecked = time.Now()
+	state.healthy = err == nil
+	if err == nil {
+		// a recovered check no longer reports its last failure
+		state.lastError = ""
+		state.lastErrorAt = time.Time{}
+		return
+	}
+	state.lastError = err.Error()
+	state.lastErrorAt = state.lastChecked
+	logger.Error(ctx, ctxName, "check %s failed: %v", state.checker.Name, err)
 }
@@ -0,0 +1,197 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go-bunrouter-gorm-example/infrastructure/httplib"
+	"go-bunrouter-gorm-example/infrastructure/jobs"
+	logger "go-bunrouter-gorm-example/infrastructure/log"
+	"go-bunrouter-gorm-example/module/primitive"
+	"go-bunrouter-gorm-example/utils"
+
+	"github.com/uptrace/bunrouter"
+)
+
+var jobStatuses = []string{
+	jobs.StatusQueued,
+	jobs.StatusRunning,
+	jobs.StatusSucceeded,
+	jobs.StatusFailed,
+	jobs.StatusDead,
+	jobs.StatusCancelled,
+}
+
+type Http struct {
+	serviceJob InterfaceService
+}
+
+func NewHttp(serviceJob InterfaceService) InterfaceHttp {
+	return &Http{
+		serviceJob: serviceJob,
+	}
+}
+
+type InterfaceHttp interface {
+	GroupJob(group *bunrouter.Group)
+	GroupAdminJob(group *bunrouter.Group)
+}
+
+func (h *Http) GroupJob(g *bunrouter.Group) {
+	g.GET("/:id", h.DetailJob)
+}
+
+// GroupAdminJob registers the endpoints operating the queue, they are meant
+// to be mounted under the admin group
+func (h *Http) GroupAdminJob(g *bunrouter.Group) {
+	g.GET("", h.GetListJob)
+	g.GET("/:id", h.DetailJob)
+	g.POST("/:id/retry", h.RetryJob)
+	g.POST("/:id/cancel", h.CancelJob)
+}
+
+// jobIDFromParam reads the id path parameter, it must be a positive integer
+func jobIDFromParam(c bunrouter.Request) (int64, error) {
+	jobID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || jobID <= 0 {
+		return 0, errors.New(primitive.ParamIdIsZeroOrNullString)
+	}
+	return jobID, nil
+}
+
+// setJobErrorResponse answers the errors of the queue operations
+func setJobErrorResponse(w http.ResponseWriter, err error) error {
+	switch {
+	case errors.Is(err, jobs.ErrJobNotFound):
+		return httplib.SetErrorResponse(w, http.StatusNotFound, primitive.RecordJobNotFound)
+	case errors.Is(err, jobs.ErrJobState):
+		return httplib.SetErrorResponse(w, http.StatusConflict, err.Error())
+	default:
+		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
+	}
+}
+
+// DetailJob reports the status and the progress of a background job
+func (h *Http) DetailJob(w http.ResponseWriter, c bunrouter.Request) error {
+	logCtx := fmt.Sprintf("handler.DetailJob")
+	ctx := c.Context()
+
+	if h.serviceJob == nil {
+		err := errors.New("dependency service job to handler job on method DetailJob is nil")
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceJob")
+		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
+	}
+
+	jobID, err := jobIDFromParam(c)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "jobIDFromParam")
+		return httplib.SetErrorResponse(w, http.StatusBadRequest, primitive.ParamIdIsZeroOrNullString)
+	}
+
+	data, err := h.serviceJob.GetDetailJob(ctx, jobID)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceJob.GetDetailJob")
+		return setJobErrorResponse(w, err)
+	}
+
+	return httplib.SetSuccessResponse(w, http.StatusOK, primitive.SuccessGetJob, data)
+
+}
+
+// GetListJob lists the jobs newest first, filtered by kind and status
+func (h *Http) GetListJob(w http.ResponseWriter, c bunrouter.Request) error {
+	logCtx := fmt.Sprintf("handler.GetListJob")
+	ctx := c.Context()
+
+	if h.serviceJob == nil {
+		err := errors.New("dependency service job to handler job on method GetListJob is nil")
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceJob")
+		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
+	}
+
+	paginationQuery, err := httplib.GetPaginationFromCtx(c)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "httplib.GetPaginationFromCtx")
+		return httplib.SetErrorResponse(w, http.StatusBadRequest, err.Error())
+	}
+
+	status := c.Request.URL.Query().Get("status")
+	if status != "" && !utils.Contains(jobStatuses, status) {
+		err = fmt.Errorf("unknown job status %q", status)
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "utils.Contains")
+		return httplib.SetErrorResponse(w, http.StatusBadRequest, primitive.JobStatusInvalid)
+	}
+
+	data, count, err := h.serviceJob.GetListJob(ctx, primitive.ParameterJobHandler{
+		Kind:   c.Request.URL.Query().Get("kind"),
+		Status: status,
+	}, paginationQuery)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceJob.GetListJob")
+		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
+	}
+
+	return httplib.SetPaginationResponse(w,
+		http.StatusOK,
+		primitive.SuccessGetJob,
+		data,
+		uint64(count),
+		paginationQuery)
+
+}
+
+// RetryJob queues a failed, dead or cancelled job again
+func (h *Http) RetryJob(w http.ResponseWriter, c bunrouter.Request) error {
+	logCtx := fmt.Sprintf("handler.RetryJob")
+	ctx := c.Context()
+
+	if h.serviceJob == nil {
+		err := errors.New("dependency service job to handler job on method RetryJob is nil")
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceJob")
+		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
+	}
+
+	jobID, err := jobIDFromParam(c)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "jobIDFromParam")
+		return httplib.SetErrorResponse(w, http.StatusBadRequest, primitive.ParamIdIsZeroOrNullString)
+	}
+
+	data, err := h.serviceJob.RetryJob(ctx, jobID)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceJob.RetryJob")
+		return setJobErrorResponse(w, err)
+	}
+
+	return httplib.SetSuccessResponse(w, http.StatusOK, primitive.SuccessRetryJob, data)
+
+}
+
+// CancelJob stops a queued or running job
+func (h *Http) CancelJob(w http.ResponseWriter, c bunrouter.Request) error {
+	logCtx := fmt.Sprintf("handler.CancelJob")
+	ctx := c.Context()
+
+	if h.serviceJob == nil {
+		err := errors.New("dependency service job to handler job on method CancelJob is nil")
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceJob")
+		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
+	}
+
+	jobID, err := jobIDFromParam(c)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "jobIDFromParam")
+		return httplib.SetErrorResponse(w, http.StatusBadRequest, primitive.ParamIdIsZeroOrNullString)
+	}
+
+	data, err := h.serviceJob.CancelJob(ctx, jobID)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceJob.CancelJob")
+		return setJobErrorResponse(w, err)
+	}
+
+	return httplib.SetSuccessResponse(w, http.StatusOK, primitive.SuccessCancelJob, data)
+
+}
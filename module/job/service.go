@@ -0,0 +1,118 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go-bunrouter-gorm-example/infrastructure/httplib"
+	"go-bunrouter-gorm-example/infrastructure/jobs"
+	logger "go-bunrouter-gorm-example/infrastructure/log"
+	"go-bunrouter-gorm-example/module/primitive"
+	"go-bunrouter-gorm-example/utils"
+)
+
+// QueueInterface is the part of jobs.Queue the job module reads and
+// operates on
+type QueueInterface interface {
+	Get(ctx context.Context, id int64) (jobs.Job, error)
+	List(ctx context.Context, filter jobs.Filter) ([]jobs.Job, int64, error)
+	Retry(ctx context.Context, id int64) (jobs.Job, error)
+	Cancel(ctx context.Context, id int64) (jobs.Job, error)
+}
+
+type InterfaceService interface {
+	GetDetailJob(ctx context.Context, jobID int64) (primitive.JobResp, error)
+	GetListJob(ctx context.Context, param primitive.ParameterJobHandler, pagination *httplib.Query) (resp []primitive.JobResp, count int64, err error)
+	RetryJob(ctx context.Context, jobID int64) (primitive.JobResp, error)
+	CancelJob(ctx context.Context, jobID int64) (primitive.JobResp, error)
+}
+
+type Service struct {
+	queue QueueInterface
+}
+
+func NewService(queue QueueInterface) InterfaceService {
+	return &Service{
+		queue: queue,
+	}
+}
+
+func (s Service) GetDetailJob(ctx context.Context, jobID int64) (primitive.JobResp, error) {
+	logCtx := fmt.Sprintf("service.GetDetailJob")
+
+	data, err := s.queue.Get(ctx, jobID)
+	if err != nil {
+		if !errors.Is(err, jobs.ErrJobNotFound) {
+			logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.queue.Get")
+		}
+		return primitive.JobResp{}, err
+	}
+	return toJobResp(data), nil
+}
+
+func (s Service) GetListJob(ctx context.Context, param primitive.ParameterJobHandler, pagination *httplib.Query) (resp []primitive.JobResp, count int64, err error) {
+	logCtx := fmt.Sprintf("service.GetListJob")
+
+	list, count, err := s.queue.List(ctx, jobs.Filter{
+		Kind:   param.Kind,
+		Status: param.Status,
+		Limit:  pagination.GetSize(),
+		Offset: pagination.GetOffset(),
+	})
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.queue.List")
+		return nil, 0, err
+	}
+
+	resp = make([]primitive.JobResp, 0, len(list))
+	for _, data := range list {
+		resp = append(resp, toJobResp(data))
+	}
+	return resp, count, nil
+}
+
+func (s Service) RetryJob(ctx context.Context, jobID int64) (primitive.JobResp, error) {
+	logCtx := fmt.Sprintf("service.RetryJob")
+
+	data, err := s.queue.Retry(ctx, jobID)
+	if err != nil {
+		if !errors.Is(err, jobs.ErrJobNotFound) && !errors.Is(err, jobs.ErrJobState) {
+			logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.queue.Retry")
+		}
+		return primitive.JobResp{}, err
+	}
+	return toJobResp(data), nil
+}
+
+func (s Service) CancelJob(ctx context.Context, jobID int64) (primitive.JobResp, error) {
+	logCtx := fmt.Sprintf("service.CancelJob")
+
+	data, err := s.queue.Cancel(ctx, jobID)
+	if err != nil {
+		if !errors.Is(err, jobs.ErrJobNotFound) && !errors.Is(err, jobs.ErrJobState) {
+			logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.queue.Cancel")
+		}
+		return primitive.JobResp{}, err
+	}
+	return toJobResp(data), nil
+}
+
+func toJobResp(data jobs.Job) primitive.JobResp {
+	return primitive.JobResp{
+		ID:          data.ID,
+		Kind:        data.Kind,
+		Status:      data.Status,
+		Params:      data.Params,
+		Progress:    data.Progress,
+		Error:       data.Error,
+		Attempts:    data.Attempts,
+		MaxAttempts: data.MaxAttempts,
+		RunAt:       data.RunAt,
+		LockedUntil: data.LockedUntil,
+		CreatedAt:   data.CreatedAt,
+		UpdatedAt:   data.UpdatedAt,
+		StartedAt:   data.StartedAt,
+		FinishedAt:  data.FinishedAt,
+	}
+}
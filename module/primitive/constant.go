@@ -9,4 +9,27 @@ const (
 	ErrorBindBodyRequest             = "error bind body from request"
 	SomethingWrongWithTheBodyRequest = "oops, something wrong with body request, please recheck!"
 	SomethingWentWrong               = "oops, something went wrong!"
+	ServiceNotReady                  = "service is not ready to accept traffic"
+	ServiceNotStarted                = "service has not finished starting"
+	DependencyUnavailable            = "service is temporarily unavailable, please retry later"
+	SuccessBatchArticle              = "success process batch article"
+	BatchArticleInvalid              = "batch has invalid items, nothing was applied"
+	BatchArticleNotApplied           = "batch failed, nothing was applied"
+	BatchArticleTooLarge             = "batch has more items than allowed"
+	ExportFormatInvalid              = "format must be either csv or ndjson"
+	SuccessImportArticle             = "success start import article"
+	ImportFileMissing                = "the file field of the multipart body is missing"
+	ImportFileTooLarge               = "the uploaded file is larger than allowed"
+	ImportFormatInvalid              = "format must be either csv or ndjson, set it or use a .csv or .ndjson file"
+	ImportFileInvalid                = "the uploaded file can not be imported"
+	SuccessGetJob                    = "success get record job"
+	RecordJobNotFound                = "record data job not found"
+	SuccessRetryJob                  = "success retry job"
+	SuccessCancelJob                 = "success cancel job"
+	JobStatusInvalid                 = "status must be one of queued, running, succeeded, failed, dead or cancelled"
+	SuccessGetSchedule               = "success get record schedule"
+	SuccessGetScheduleRun            = "success get record schedule run"
+	SuccessRunSchedule               = "success start schedule run"
+	RecordScheduleNotFound           = "record data schedule not found"
+	ScheduleAlreadyRunning           = "the task is already running, retry once it finished"
 )
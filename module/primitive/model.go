@@ -11,6 +11,9 @@ type Article struct {
 	UpdatedAt time.Time `gorm:"column:updated_at"`
 }
 
+// JobKindArticleImport is the kind of the background jobs importing articles
+const JobKindArticleImport = "article.import"
+
 type ParameterFindArticle struct {
 	Query     string
 	Author    string
@@ -24,3 +27,8 @@ type ParameterArticleHandler struct {
 	Query  string
 	Author string
 }
+
+type ParameterJobHandler struct {
+	Kind   string
+	Status string
+}
@@ -5,3 +5,48 @@ type ArticleReq struct {
 	Title  string `json:"title" validate:"required"`
 	Body   string `json:"body" validate:"required"`
 }
+
+const (
+	BatchModeTransactional = "transactional"
+	BatchModeBestEffort    = "bestEffort"
+
+	BatchOpCreate = "create"
+	BatchOpUpdate = "update"
+	BatchOpDelete = "delete"
+)
+
+// ArticleBatchReq is a bulk write, a transactional batch applies every item
+// or none, a best effort batch applies the valid items it can
+type ArticleBatchReq struct {
+	Mode  string             `json:"mode" validate:"omitempty,oneof=transactional bestEffort"`
+	Items []ArticleBatchItem `json:"items" validate:"required,min=1"`
+}
+
+// ArticleBatchItem creates an article, or updates or deletes the article id
+type ArticleBatchItem struct {
+	Op      string      `json:"op" validate:"required,oneof=create update delete"`
+	ID      int64       `json:"id" validate:"required_unless=Op create,gte=0"`
+	Article *ArticleReq `json:"article" validate:"required_unless=Op delete"`
+}
+
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+)
+
+// ArticleImportReq is an uploaded file of articles, every row is validated
+// like an ArticleReq
+type ArticleImportReq struct {
+	Filename string
+	Format   string
+	DryRun   bool
+	Data     []byte
+}
+
+// ArticleImportParams are the params of an article import job
+type ArticleImportParams struct {
+	Filename string `json:"filename"`
+	Format   string `json:"format"`
+	DryRun   bool   `json:"dryRun"`
+	Size     int    `json:"size"`
+}
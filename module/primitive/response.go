@@ -1,6 +1,9 @@
 package primitive
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type ArticleResp struct {
 	ID        int64     `json:"id"`
@@ -11,7 +14,115 @@ type ArticleResp struct {
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
-type HealthResp struct {
-	Db    string `json:"db"`
-	Redis string `json:"redis"`
+const (
+	BatchStatusCreated    = "created"
+	BatchStatusUpdated    = "updated"
+	BatchStatusDeleted    = "deleted"
+	BatchStatusInvalid    = "invalid"
+	BatchStatusNotFound   = "not_found"
+	BatchStatusFailed     = "failed"
+	BatchStatusNotApplied = "not_applied"
+)
+
+type ArticleBatchItemResp struct {
+	Index   int          `json:"index"`
+	Op      string       `json:"op"`
+	ID      int64        `json:"id,omitempty"`
+	Status  string       `json:"status"`
+	Article *ArticleResp `json:"article,omitempty"`
+	Errors  []string     `json:"errors,omitempty"`
+}
+
+type ArticleBatchResp struct {
+	Mode      string                 `json:"mode"`
+	Succeeded int                    `json:"succeeded"`
+	Failed    int                    `json:"failed"`
+	Items     []ArticleBatchItemResp `json:"items"`
+}
+
+type JobResp struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Status      string          `json:"status"`
+	Params      json.RawMessage `json:"params"`
+	Progress    json.RawMessage `json:"progress"`
+	Error       string          `json:"error,omitempty"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	RunAt       time.Time       `json:"runAt"`
+	LockedUntil *time.Time      `json:"lockedUntil,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   *time.Time      `json:"updatedAt,omitempty"`
+	StartedAt   *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// ArticleImportProgress is the progress of an article import job, rows are
+// numbered from 1 without the csv header. Total stays 0 until the last row has
+// been read. A dry run counts the rows it would have created in Created.
+type ArticleImportProgress struct {
+	Total           int                     `json:"total"`
+	Processed       int                     `json:"processed"`
+	Created         int                     `json:"created"`
+	Skipped         int                     `json:"skipped"`
+	Errors          []ArticleImportRowError `json:"errors"`
+	ErrorsTruncated bool                    `json:"errorsTruncated,omitempty"`
+}
+
+type ArticleImportRowError struct {
+	Row    int      `json:"row"`
+	Errors []string `json:"errors"`
+}
+
+// ArticlePurgeResult is the outcome of a purge of the deleted articles
+type ArticlePurgeResult struct {
+	Purged        int64     `json:"purged"`
+	DeletedBefore time.Time `json:"deletedBefore"`
+}
+
+// ArticleWarmResult is the outcome of a warm up of the list cache, Pages is
+// 0 when no cache is available
+type ArticleWarmResult struct {
+	Pages      int    `json:"pages"`
+	Generation string `json:"generation,omitempty"`
+}
+
+type ScheduleResp struct {
+	Name      string           `json:"name"`
+	Schedule  string           `json:"schedule"`
+	Enabled   bool             `json:"enabled"`
+	Jitter    string           `json:"jitter"`
+	Timeout   string           `json:"timeout"`
+	NextRunAt *time.Time       `json:"nextRunAt,omitempty"`
+	LastRun   *ScheduleRunResp `json:"lastRun,omitempty"`
+}
+
+type ScheduleRunResp struct {
+	ID          int64           `json:"id"`
+	Task        string          `json:"task"`
+	Trigger     string          `json:"trigger"`
+	Status      string          `json:"status"`
+	Replica     string          `json:"replica"`
+	ScheduledAt time.Time       `json:"scheduledAt"`
+	StartedAt   time.Time       `json:"startedAt"`
+	FinishedAt  *time.Time      `json:"finishedAt,omitempty"`
+	DurationMs  *int64          `json:"durationMs,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
+
+type HealthCheckResp struct {
+	Status        string     `json:"status"`
+	LatencyMs     int64      `json:"latencyMs"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorAt   *time.Time `json:"lastErrorAt,omitempty"`
+	LastCheckedAt time.Time  `json:"lastCheckedAt"`
+	Optional      bool       `json:"optional,omitempty"`
+}
+
+type ProbeResp struct {
+	Status string                     `json:"status"`
+	Uptime string                     `json:"uptime"`
+	Reason string                     `json:"reason,omitempty"`
+	Checks map[string]HealthCheckResp `json:"checks,omitempty"`
 }
@@ -0,0 +1,126 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go-bunrouter-gorm-example/infrastructure/httplib"
+	logger "go-bunrouter-gorm-example/infrastructure/log"
+	"go-bunrouter-gorm-example/infrastructure/scheduler"
+	"go-bunrouter-gorm-example/module/primitive"
+	"go-bunrouter-gorm-example/utils"
+
+	"github.com/uptrace/bunrouter"
+)
+
+type Http struct {
+	serviceSchedule InterfaceService
+}
+
+func NewHttp(serviceSchedule InterfaceService) InterfaceHttp {
+	return &Http{
+		serviceSchedule: serviceSchedule,
+	}
+}
+
+type InterfaceHttp interface {
+	GroupAdminSchedule(group *bunrouter.Group)
+}
+
+// GroupAdminSchedule registers the endpoints operating the recurring tasks,
+// they are meant to be mounted under the admin group
+func (h *Http) GroupAdminSchedule(g *bunrouter.Group) {
+	g.GET("", h.GetListSchedule)
+	g.GET("/:name/runs", h.GetListScheduleRun)
+	g.POST("/:name/run", h.RunSchedule)
+}
+
+// setScheduleErrorResponse answers the errors of the scheduler operations
+func setScheduleErrorResponse(w http.ResponseWriter, err error) error {
+	switch {
+	case errors.Is(err, scheduler.ErrTaskNotFound):
+		return httplib.SetErrorResponse(w, http.StatusNotFound, primitive.RecordScheduleNotFound)
+	case errors.Is(err, scheduler.ErrTaskRunning):
+		return httplib.SetErrorResponse(w, http.StatusConflict, primitive.ScheduleAlreadyRunning)
+	case errors.Is(err, scheduler.ErrNotRunning):
+		return httplib.SetErrorResponse(w, http.StatusServiceUnavailable, primitive.DependencyUnavailable)
+	default:
+		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
+	}
+}
+
+// GetListSchedule lists the recurring tasks with their next and last run
+func (h *Http) GetListSchedule(w http.ResponseWriter, c bunrouter.Request) error {
+	logCtx := fmt.Sprintf("handler.GetListSchedule")
+	ctx := c.Context()
+
+	if h.serviceSchedule == nil {
+		err := errors.New("dependency service schedule to handler schedule on method GetListSchedule is nil")
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceSchedule")
+		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
+	}
+
+	data, err := h.serviceSchedule.GetListSchedule(ctx)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceSchedule.GetListSchedule")
+		return setScheduleErrorResponse(w, err)
+	}
+
+	return httplib.SetSuccessResponse(w, http.StatusOK, primitive.SuccessGetSchedule, data)
+
+}
+
+// GetListScheduleRun lists the run history of a task, newest first
+func (h *Http) GetListScheduleRun(w http.ResponseWriter, c bunrouter.Request) error {
+	logCtx := fmt.Sprintf("handler.GetListScheduleRun")
+	ctx := c.Context()
+
+	if h.serviceSchedule == nil {
+		err := errors.New("dependency service schedule to handler schedule on method GetListScheduleRun is nil")
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceSchedule")
+		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
+	}
+
+	paginationQuery, err := httplib.GetPaginationFromCtx(c)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "httplib.GetPaginationFromCtx")
+		return httplib.SetErrorResponse(w, http.StatusBadRequest, err.Error())
+	}
+
+	data, count, err := h.serviceSchedule.GetListScheduleRun(ctx, c.Param("name"), paginationQuery)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceSchedule.GetListScheduleRun")
+		return setScheduleErrorResponse(w, err)
+	}
+
+	return httplib.SetPaginationResponse(w,
+		http.StatusOK,
+		primitive.SuccessGetScheduleRun,
+		data,
+		uint64(count),
+		paginationQuery)
+
+}
+
+// RunSchedule starts a run of a task now, the run goes on in the background
+// and shows in the run history
+func (h *Http) RunSchedule(w http.ResponseWriter, c bunrouter.Request) error {
+	logCtx := fmt.Sprintf("handler.RunSchedule")
+	ctx := c.Context()
+
+	if h.serviceSchedule == nil {
+		err := errors.New("dependency service schedule to handler schedule on method RunSchedule is nil")
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceSchedule")
+		return httplib.SetErrorResponse(w, http.StatusInternalServerError, primitive.SomethingWentWrong)
+	}
+
+	data, err := h.serviceSchedule.RunSchedule(ctx, c.Param("name"))
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceSchedule.RunSchedule")
+		return setScheduleErrorResponse(w, err)
+	}
+
+	return httplib.SetSuccessResponse(w, http.StatusAccepted, primitive.SuccessRunSchedule, data)
+
+}
@@ -0,0 +1,123 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go-bunrouter-gorm-example/infrastructure/httplib"
+	logger "go-bunrouter-gorm-example/infrastructure/log"
+	"go-bunrouter-gorm-example/infrastructure/scheduler"
+	"go-bunrouter-gorm-example/module/primitive"
+	"go-bunrouter-gorm-example/utils"
+)
+
+// SchedulerInterface is the part of scheduler.Scheduler the schedule module
+// reads and operates on
+type SchedulerInterface interface {
+	Tasks(ctx context.Context) ([]scheduler.TaskInfo, error)
+	HasTask(name string) bool
+	Runs(ctx context.Context, filter scheduler.Filter) ([]scheduler.Run, int64, error)
+	Trigger(ctx context.Context, name string) (scheduler.Run, error)
+}
+
+type InterfaceService interface {
+	GetListSchedule(ctx context.Context) ([]primitive.ScheduleResp, error)
+	GetListScheduleRun(ctx context.Context, name string, pagination *httplib.Query) (resp []primitive.ScheduleRunResp, count int64, err error)
+	RunSchedule(ctx context.Context, name string) (primitive.ScheduleRunResp, error)
+}
+
+type Service struct {
+	scheduler SchedulerInterface
+}
+
+func NewService(scheduler SchedulerInterface) InterfaceService {
+	return &Service{
+		scheduler: scheduler,
+	}
+}
+
+func (s Service) GetListSchedule(ctx context.Context) ([]primitive.ScheduleResp, error) {
+	logCtx := fmt.Sprintf("service.GetListSchedule")
+
+	list, err := s.scheduler.Tasks(ctx)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.scheduler.Tasks")
+		return nil, err
+	}
+
+	resp := make([]primitive.ScheduleResp, 0, len(list))
+	for _, data := range list {
+		item := primitive.ScheduleResp{
+			Name:      data.Name,
+			Schedule:  data.Schedule,
+			Enabled:   data.Enabled,
+			Jitter:    data.Jitter.String(),
+			Timeout:   data.Timeout.String(),
+			NextRunAt: data.NextRunAt,
+		}
+		if data.LastRun != nil {
+			lastRun := toScheduleRunResp(*data.LastRun)
+			item.LastRun = &lastRun
+		}
+		resp = append(resp, item)
+	}
+	return resp, nil
+}
+
+func (s Service) GetListScheduleRun(ctx context.Context, name string, pagination *httplib.Query) (resp []primitive.ScheduleRunResp, count int64, err error) {
+	logCtx := fmt.Sprintf("service.GetListScheduleRun")
+
+	if !s.scheduler.HasTask(name) {
+		return nil, 0, scheduler.ErrTaskNotFound
+	}
+
+	list, count, err := s.scheduler.Runs(ctx, scheduler.Filter{
+		Task:   name,
+		Limit:  pagination.GetSize(),
+		Offset: pagination.GetOffset(),
+	})
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.scheduler.Runs")
+		return nil, 0, err
+	}
+
+	resp = make([]primitive.ScheduleRunResp, 0, len(list))
+	for _, data := range list {
+		resp = append(resp, toScheduleRunResp(data))
+	}
+	return resp, count, nil
+}
+
+func (s Service) RunSchedule(ctx context.Context, name string) (primitive.ScheduleRunResp, error) {
+	logCtx := fmt.Sprintf("service.RunSchedule")
+
+	data, err := s.scheduler.Trigger(ctx, name)
+	if err != nil {
+		if !errors.Is(err, scheduler.ErrTaskNotFound) && !errors.Is(err, scheduler.ErrTaskRunning) {
+			logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.scheduler.Trigger")
+		}
+		return primitive.ScheduleRunResp{}, err
+	}
+	return toScheduleRunResp(data), nil
+}
+
+func toScheduleRunResp(data scheduler.Run) primitive.ScheduleRunResp {
+	resp := primitive.ScheduleRunResp{
+		ID:          data.ID,
+		Task:        data.Task,
+		Trigger:     data.Trigger,
+		Status:      data.Status,
+		Replica:     data.Replica,
+		ScheduledAt: data.ScheduledAt,
+		StartedAt:   data.StartedAt,
+		FinishedAt:  data.FinishedAt,
+		Result:      data.Result,
+		Error:       data.Error,
+	}
+	if data.FinishedAt != nil {
+		duration := data.FinishedAt.Sub(data.StartedAt).Milliseconds()
+		resp.DurationMs = &duration
+	}
+	return resp
+}
@@ -6,7 +6,9 @@ import (
 	"go-bunrouter-gorm-example/boot"
 	"go-bunrouter-gorm-example/infrastructure/config"
 	"go-bunrouter-gorm-example/infrastructure/httplib"
+	"go-bunrouter-gorm-example/infrastructure/metrics"
 	"go-bunrouter-gorm-example/infrastructure/middleware"
+	"go-bunrouter-gorm-example/module/article"
 
 	"github.com/uptrace/bunrouter"
 	"github.com/uptrace/bunrouter/extra/reqlog"
@@ -51,10 +53,18 @@ func (hr *HandlerRouter) RouterWithMiddleware() *bunrouter.Router {
 			reqlog.FromEnv("BUNDEBUG"))).Verbose()
 	}
 
+	//probes live on the root endpoint, outside the rate limited api group
+	root := c.NewGroup("")
+	hr.Setup.HealthHttp.GroupProbe(root)
+	root.GET("/metrics", bunrouter.HTTPHandler(metrics.Handler()))
+
 	//grouping on root endpoint
 	api := c.NewGroup("/api")
 
-	api.Use(middleware.RateLimiterMiddleware(hr.Setup.Limiter))
+	api = api.Use(middleware.RateLimiterMiddleware(hr.Setup.Limiter))
+	api = api.Use(middleware.ReadYourWritesMiddleware(config.Conf.Postgres.ReadYourWritesWindow))
+	api = api.Use(middleware.IdempotencyMiddleware(hr.Setup.Idempotency, config.Conf.Idempotency.MaxBodyBytes,
+		config.Conf.Articles.ImportMaxBytes+article.ImportMultipartOverhead))
 
 	//grouping on "api/v1"
 	v1 := api.NewGroup("/v1")
@@ -66,6 +76,19 @@ func (hr *HandlerRouter) RouterWithMiddleware() *bunrouter.Router {
 	//module article
 	prefixArticle := v1.NewGroup("/articles")
 	hr.Setup.ArticleHttp.GroupArticle(prefixArticle)
+	hr.Setup.ArticleHttp.GroupArticleMethod(v1)
+
+	//module job
+	prefixJob := v1.NewGroup("/jobs")
+	hr.Setup.JobHttp.GroupJob(prefixJob)
+	//the admin endpoints need the admin token
+	admin := v1.NewGroup("/admin").Use(middleware.AdminTokenMiddleware(config.Conf.Admin.Token))
+	prefixAdminJob := admin.NewGroup("/jobs")
+	hr.Setup.JobHttp.GroupAdminJob(prefixAdminJob)
+
+	//module schedule
+	prefixAdminSchedule := admin.NewGroup("/schedules")
+	hr.Setup.ScheduleHttp.GroupAdminSchedule(prefixAdminSchedule)
 
 	return c
 
@@ -0,0 +1,116 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/uptrace/bunrouter"
+)
+
+// Route is an endpoint registered on the router
+type Route struct {
+	Method string
+	Path   string
+}
+
+// routeMethods maps the handler fields of a bunrouter node to their method
+var routeMethods = []struct {
+	field  string
+	method string
+}{
+	{"get", http.MethodGet},
+	{"post", http.MethodPost},
+	{"put", http.MethodPut},
+	{"patch", http.MethodPatch},
+	{"delete", http.MethodDelete},
+	{"head", http.MethodHead},
+	{"options", http.MethodOptions},
+}
+
+// Routes walks the route tree of c and lists its endpoints ordered by path
+// and method. bunrouter keeps the tree unexported, it is read by reflection
+// so the modules keep registering their endpoints on a group. A tree that
+// does not have the expected shape, e.g. after a bunrouter upgrade, is an
+// error.
+func Routes(c *bunrouter.Router) ([]Route, error) {
+	tree, err := routeField(reflect.ValueOf(c).Elem(), "tree", reflect.Struct)
+	if err != nil {
+		return nil, err
+	}
+	var routes []Route
+	if err = walkRoutes(tree, &routes); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Path == routes[j].Path {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	return routes, nil
+}
+
+func walkRoutes(node reflect.Value, routes *[]Route) error {
+	handlers, err := routeField(node, "handlerMap", reflect.Ptr)
+	if err != nil {
+		return err
+	}
+	if !handlers.IsNil() {
+		path, err := routeField(node, "route", reflect.String)
+		if err != nil {
+			return err
+		}
+		for _, m := range routeMethods {
+			handler, err := routeField(handlers.Elem(), m.field, reflect.Ptr)
+			if err != nil {
+				return err
+			}
+			if !handler.IsNil() {
+				*routes = append(*routes, Route{Method: m.method, Path: path.String()})
+			}
+		}
+	}
+
+	colon, err := routeField(node, "colon", reflect.Ptr)
+	if err != nil {
+		return err
+	}
+	if !colon.IsNil() {
+		if err = walkRoutes(colon.Elem(), routes); err != nil {
+			return err
+		}
+	}
+
+	nodes, err := routeField(node, "nodes", reflect.Slice)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < nodes.Len(); i++ {
+		child := nodes.Index(i)
+		if child.Kind() != reflect.Ptr || child.IsNil() {
+			return fmt.Errorf("router: unexpected bunrouter node %s", child.Type())
+		}
+		if err = walkRoutes(child.Elem(), routes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// routeField returns the field name of the struct v, it must be of kind
+func routeField(v reflect.Value, name string, kind reflect.Kind) (reflect.Value, error) {
+	if !v.IsValid() || v.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("router: unexpected bunrouter tree, %s is not in a struct", name)
+	}
+	field := v.FieldByName(name)
+	if !field.IsValid() {
+		return reflect.Value{}, fmt.Errorf("router: bunrouter %s has no field %s", v.Type(), name)
+	}
+	if field.Kind() != kind {
+		return reflect.Value{}, fmt.Errorf("router: bunrouter %s.%s is a %s, not a %s", v.Type(), name, field.Kind(), kind)
+	}
+	return field, nil
+}
@@ -0,0 +1,65 @@
+package router
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/uptrace/bunrouter"
+)
+
+func TestRoutes(t *testing.T) {
+	handler := func(w http.ResponseWriter, req bunrouter.Request) error { return nil }
+
+	c := bunrouter.New()
+	c.GET("/healthz", handler)
+	c.WithGroup("/api/v1/articles", func(g *bunrouter.Group) {
+		g.GET("", handler)
+		g.POST("", handler)
+		g.GET("/:id", handler)
+		g.PUT("/:id", handler)
+		g.DELETE("/:id", handler)
+	})
+	c.GET("/static/*path", handler)
+
+	routes, err := Routes(c)
+	if err != nil {
+		t.Fatalf("Routes() error = %v", err)
+	}
+
+	want := []Route{
+		{Method: http.MethodGet, Path: "/api/v1/articles"},
+		{Method: http.MethodPost, Path: "/api/v1/articles"},
+		{Method: http.MethodDelete, Path: "/api/v1/articles/:id"},
+		{Method: http.MethodGet, Path: "/api/v1/articles/:id"},
+		{Method: http.MethodPut, Path: "/api/v1/articles/:id"},
+		{Method: http.MethodGet, Path: "/healthz"},
+		{Method: http.MethodGet, Path: "/static/*path"},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("Routes() = %v, want %v", routes, want)
+	}
+}
+
+func TestRoutesEmpty(t *testing.T) {
+	routes, err := Routes(bunrouter.New())
+	if err != nil {
+		t.Fatalf("Routes() error = %v", err)
+	}
+	if len(routes) != 0 {
+		t.Errorf("Routes() = %v, want none", routes)
+	}
+}
+
+func TestRouteFieldMissing(t *testing.T) {
+	v := reflect.ValueOf(struct{ route string }{})
+	if _, err := routeField(v, "handlerMap", reflect.Ptr); err == nil {
+		t.Error("routeField() of a missing field returned no error")
+	}
+	if _, err := routeField(v, "route", reflect.Slice); err == nil {
+		t.Error("routeField() of a field of another kind returned no error")
+	}
+	if _, err := routeField(reflect.Value{}, "route", reflect.String); err == nil {
+		t.Error("routeField() of an invalid value returned no error")
+	}
+}
@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronDescriptors are the @ shorthands accepted by ParseCron
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	cronMonthNames = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	cronDayNames = map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}
+)
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: cronMonthNames},
+	// 7 is sunday too
+	{name: "day of week", min: 0, max: 7, names: cronDayNames},
+}
+
+// Cron is a parsed five field cron expression: minute, hour, day of month,
+// month and day of week
+type Cron struct {
+	spec   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// a day field starting with * does not restrict the day, otherwise a day
+	// matches when either day field does
+	domStar bool
+	dowStar bool
+}
+
+// ParseCron parses a cron expression such as "*/15 2-4 * * mon-fri". A field
+// is a comma separated list of *, values, ranges and steps, months and days
+// of week may be named. The @yearly, @monthly, @weekly, @daily and @hourly
+// shorthands are accepted too.
+func ParseCron(spec string) (Cron, error) {
+	expr := strings.TrimSpace(spec)
+	if descriptor, ok := cronDescriptors[strings.ToLower(expr)]; ok {
+		expr = descriptor
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return Cron{}, fmt.Errorf("cron %q: expected %d fields, got %d", spec, len(cronFields), len(fields))
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		value, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return Cron{}, fmt.Errorf("cron %q: %w", spec, err)
+		}
+		bits[i] = value
+	}
+	//fold sunday as 7 onto 0
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = bits[4]&^(1<<7) | 1
+	}
+	return Cron{
+		spec:    strings.TrimSpace(spec),
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s: invalid step %q", spec.name, stepPart)
+			}
+			step = n
+		}
+
+		var low, high int
+		switch {
+		case rangePart == "*":
+			low, high = spec.min, spec.max
+		case strings.Contains(rangePart, "-"):
+			lowPart, highPart, _ := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = parseCronValue(lowPart, spec); err != nil {
+				return 0, err
+			}
+			if high, err = parseCronValue(highPart, spec); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("%s: range %q ends before it starts", spec.name, rangePart)
+			}
+		default:
+			var err error
+			if low, err = parseCronValue(rangePart, spec); err != nil {
+				return 0, err
+			}
+			high = low
+			// a single value with a step runs up to the end of the field
+			if hasStep {
+				high = spec.max
+			}
+		}
+
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(value string, spec cronField) (int, error) {
+	if n, ok := spec.names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid value %q", spec.name, value)
+	}
+	if n < spec.min || n > spec.max {
+		return 0, fmt.Errorf("%s: %d is out of range %d-%d", spec.name, n, spec.min, spec.max)
+	}
+	return n, nil
+}
+
+func (c Cron) String() string {
+	return c.spec
+}
+
+// Next returns the first time after t the expression matches, in the
+// location of t. It is the zero time when nothing matches within five
+// years, e.g. for the 30th of february.
+func (c Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = advance(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+		case !c.matchDay(t):
+			t = advance(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// advance moves t to next, a local time that a daylight saving change skips
+// may resolve to an earlier instant, then t only moves by a minute
+func advance(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(time.Minute)
+}
+
+func (c Cron) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseCronInvalid(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"x * * * *",
+		"1,,2 * * * *",
+		"* * * foo *",
+		"* * * * funday",
+		"@every 5m",
+	}
+	for _, spec := range specs {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("ParseCron(%q) returned no error", spec)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a monday
+	from := time.Date(2026, 10, 19, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{name: "every 15 minutes", spec: "*/15 * * * *", from: from, want: time.Date(2026, 10, 19, 10, 15, 0, 0, time.UTC)},
+		{name: "same minute is skipped", spec: "7 10 * * *", from: from, want: time.Date(2026, 10, 20, 10, 7, 0, 0, time.UTC)},
+		{name: "daily", spec: "0 3 * * *", from: from, want: time.Date(2026, 10, 20, 3, 0, 0, 0, time.UTC)},
+		{name: "list and range", spec: "0 9-11,14 * * *", from: from, want: time.Date(2026, 10, 19, 11, 0, 0, 0, time.UTC)},
+		{name: "step on a single value", spec: "5/20 * * * *", from: from, want: time.Date(2026, 10, 19, 10, 25, 0, 0, time.UTC)},
+		{name: "step on a range", spec: "0 0-12/6 * * *", from: from, want: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)},
+		{name: "weekdays", spec: "0 0 * * 1-5", from: from, want: time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)},
+		{name: "sunday as 7", spec: "0 0 * * 7", from: from, want: time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{name: "sunday as 0", spec: "0 0 * * 0", from: from, want: time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{name: "named day", spec: "0 0 * * SUN", from: from, want: time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{name: "named month", spec: "0 12 * dec *", from: from, want: time.Date(2026, 12, 1, 12, 0, 0, 0, time.UTC)},
+		{name: "day of month or day of week", spec: "0 0 13 * 5", from: from, want: time.Date(2026, 10, 23, 0, 0, 0, 0, time.UTC)},
+		{name: "day of month or day of week, month first", spec: "0 0 20 * 5", from: from, want: time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)},
+		{name: "starred day of month restricts with day of week", spec: "0 0 */10 * 6", from: from, want: time.Date(2026, 10, 31, 0, 0, 0, 0, time.UTC)},
+		{name: "starred step on day of month", spec: "0 0 */10 * *", from: from, want: time.Date(2026, 10, 21, 0, 0, 0, 0, time.UTC)},
+		{name: "leap day", spec: "0 0 29 2 *", from: from, want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "never matches", spec: "0 0 30 2 *", from: from, want: time.Time{}},
+		{name: "hourly", spec: "@hourly", from: from, want: time.Date(2026, 10, 19, 11, 0, 0, 0, time.UTC)},
+		{name: "weekly", spec: "@weekly", from: from, want: time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{name: "yearly", spec: "@YEARLY", from: from, want: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{
+			name: "local time skipped by daylight saving",
+			spec: "30 2 * * *",
+			from: time.Date(2026, 3, 7, 12, 0, 0, 0, newYork),
+			want: time.Date(2026, 3, 9, 2, 30, 0, 0, newYork),
+		},
+		{
+			name: "hourly across daylight saving",
+			spec: "0 * * * *",
+			from: time.Date(2026, 3, 8, 1, 30, 0, 0, newYork),
+			want: time.Date(2026, 3, 8, 3, 0, 0, 0, newYork),
+		},
+		{
+			name: "hourly across the end of daylight saving",
+			spec: "0 * * * *",
+			from: time.Date(2026, 11, 1, 1, 30, 0, 0, newYork),
+			want: time.Date(2026, 11, 1, 1, 30, 0, 0, newYork).Add(30 * time.Minute),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := ParseCron(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) error = %v", tt.spec, err)
+			}
+			got := cron.Next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+			if !got.IsZero() && got.Location() != tt.from.Location() {
+				t.Errorf("Next() location = %s, want %s", got.Location(), tt.from.Location())
+			}
+		})
+	}
+}
+
+func TestCronString(t *testing.T) {
+	cron, err := ParseCron("  */5 * * * *  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cron.String(); got != "*/5 * * * *" {
+		t.Errorf("String() = %q, want the trimmed spec", got)
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	t0 := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	if got := advance(t0, t0.Add(time.Hour)); !got.Equal(t0.Add(time.Hour)) {
+		t.Errorf("advance() to a later time = %s, want %s", got, t0.Add(time.Hour))
+	}
+	// a skipped local time resolving before t must still move forward
+	if got := advance(t0, t0.Add(-time.Hour)); !got.Equal(t0.Add(time.Minute)) {
+		t.Errorf("advance() to an earlier time = %s, want %s", got, t0.Add(time.Minute))
+	}
+	if got := advance(t0, t0); !got.Equal(t0.Add(time.Minute)) {
+		t.Errorf("advance() to the same time = %s, want %s", got, t0.Add(time.Minute))
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"regexp"
+	"strings"
 	"time"
 )
 
@@ -23,7 +24,9 @@ func Contains(elems []string, elem string) bool {
 	return false
 }
 
-func StringUnitToDuration(input string) time.Duration {
+// ParseDuration parses a Go duration string such as "1m30s", the legacy
+// single unit words ("second", "minute", ...) are still accepted
+func ParseDuration(input string) (time.Duration, error) {
 	durationMapping := map[string]time.Duration{
 		"second": time.Second,
 		"minute": time.Minute,
@@ -34,20 +37,8 @@ func StringUnitToDuration(input string) time.Duration {
 		"year":   365 * 24 * time.Hour,
 	}
 
-	switch input {
-	case "second":
-		return durationMapping["second"]
-	case "minute":
-		return durationMapping["minute"]
-	case "hour":
-		return durationMapping["hour"]
-	case "week":
-		return durationMapping["week"]
-	case "month":
-		return durationMapping["month"]
-	case "year":
-		return durationMapping["year"]
-	default:
-		return time.Second
+	if duration, ok := durationMapping[strings.ToLower(strings.TrimSpace(input))]; ok {
+		return duration, nil
 	}
+	return time.ParseDuration(strings.TrimSpace(input))
 }